@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"avtest/internal/config"
+	"avtest/internal/password"
+	"avtest/internal/store"
+	"avtest/internal/store/postgres"
+)
+
+// runCreateAdmin implements the "create-admin <email>" subcommand. It
+// bootstraps the first admin, who then invites everyone else: an existing
+// account is promoted, otherwise one is created with the password read from
+// stdin. It refuses to run once the service has an active admin.
+func runCreateAdmin(cfg *config.Config, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return errors.New("usage: create-admin <email>, with the password on stdin for a new account")
+	}
+	email := args[0]
+
+	db, err := postgres.NewPostgresDB(cfg.PostgresURL)
+	if err != nil {
+		return fmt.Errorf("failed to init db connection: %w", err)
+	}
+	defer db.DB.Close()
+
+	ctx := store.WithAudit(context.Background(), store.AuditInfo{Role: store.RoleSystem})
+	active := false
+	admins, err := db.SearchUsers(ctx, store.UserQuery{Role: store.RoleAdmin, Disabled: &active, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(admins) > 0 {
+		return fmt.Errorf("%s is already an admin, use the admin API", admins[0].Email)
+	}
+
+	u, err := db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if u != nil {
+		role, enabled := store.RoleAdmin, false
+		if _, err := db.UpdateUser(ctx, store.UserUpdate{ID: u.ID, Role: &role, Disabled: &enabled, At: time.Now()}); err != nil {
+			return err
+		}
+		fmt.Printf("user %d promoted to admin\n", u.ID)
+		return nil
+	}
+
+	plain, err := readPassword(os.Stdin)
+	if err != nil {
+		return err
+	}
+	hasher, err := password.NewHasher(cfg.PasswordHashCost)
+	if err != nil {
+		return err
+	}
+	hash, err := hasher.Hash(plain)
+	if err != nil {
+		return err
+	}
+
+	u = &store.User{Email: email, Password: hash, Type: store.RoleAdmin}
+	if err := db.CreateUser(ctx, u); err != nil {
+		return err
+	}
+
+	fmt.Printf("admin %d created\n", u.ID)
+	return nil
+}
+
+// readPassword reads the first line of r.
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("password is required on stdin")
+	}
+	return line, nil
+}
@@ -1,18 +1,55 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 
 	"avtest/internal/api"
 	"avtest/internal/config"
+	"avtest/internal/events"
+	"avtest/internal/keys"
+	"avtest/internal/moderation"
+	"avtest/internal/notify"
+	"avtest/internal/outbox"
+	"avtest/internal/password"
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
 	"avtest/internal/store/postgres"
+	"avtest/internal/webhook"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
 func main() {
+	storeType := flag.String("store", "postgres", "storage backend: postgres or memory")
+	flag.Parse()
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		log.Fatalf("failed to read config: %s", err)
+	}
+
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("migrate: %s", err)
+		}
+		return
+	case "hash-passwords":
+		if err := runHashPasswords(cfg); err != nil {
+			log.Fatalf("hash-passwords: %s", err)
+		}
+		return
+	case "create-admin":
+		if err := runCreateAdmin(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("create-admin: %s", err)
+		}
+		return
+	}
+
 	logger, err := zap.NewProduction()
 	if err != nil {
 		panic(err)
@@ -22,19 +59,82 @@ func main() {
 	logger.Info("starting service")
 	defer logger.Info("service stopped")
 
-	cfg := config.NewConfig()
-
 	r := mux.NewRouter()
 
-	db, err := postgres.NewPostgresDB(cfg.PostgresURL)
+	db, err := newDatabase(*storeType, cfg)
 	if err != nil {
 		log.Fatalf("failed to init db connection: %s", err)
 	}
 
-	apiObj := api.NewAPI(logger, r, db)
+	hasher, err := password.NewHasher(cfg.PasswordHashCost)
+	if err != nil {
+		log.Fatalf("failed to init password hasher: %s", err)
+	}
+
+	jwtKeys, err := cfg.LoadJWTKeys()
+	if err != nil {
+		log.Fatalf("failed to load jwt keys: %s", err)
+	}
+	keyManager, err := keys.NewManager(jwtKeys)
+	if err != nil {
+		log.Fatalf("failed to init jwt keys: %s", err)
+	}
+
+	sweeper := moderation.NewSweeper(logger, db, cfg.LeaseSweepInterval)
+	go sweeper.Run(context.Background())
+
+	sender, err := notify.NewSender(cfg, logger)
+	if err != nil {
+		log.Fatalf("failed to init notification sender: %s", err)
+	}
+	notifier := notify.NewNotifier(logger, db, sender, cfg.PriceDropNotifyPercent)
+
+	broker := events.NewMemoryBroker()
+
+	inProcess := outbox.NewInProcessPublisher()
+	inProcess.Subscribe("notify", notifier.HandleEvent)
+	inProcess.Subscribe("webhooks", webhook.NewDispatcher(db).HandleEvent)
+	publishers, err := outbox.NewPublishers(cfg, logger, inProcess)
+	if err != nil {
+		log.Fatalf("failed to init outbox publishers: %s", err)
+	}
+	relay := outbox.NewRelay(logger, db, publishers, cfg)
+	go relay.Run(context.Background())
+
+	// With postgres, events committed by any replica reach the local SSE
+	// streams through LISTEN/NOTIFY and wake up the relay straight away.
+	if pg, ok := db.(*postgres.PostgresDB); ok {
+		listener := postgres.NewEventListener(logger, pg, cfg.PostgresURL, func(e store.Event) {
+			broker.Publish(e)
+			relay.Wake()
+		})
+		go func() {
+			if err := listener.Run(context.Background()); err != nil {
+				logger.Error("event listener stopped", zap.Error(err))
+			}
+		}()
+	} else {
+		inProcess.Subscribe("events", broker.HandleEvent)
+	}
+
+	deliverer := webhook.NewDeliverer(logger, db, cfg)
+	go deliverer.Run(context.Background())
+
+	apiObj := api.NewAPI(logger, r, db, hasher, keyManager, broker, cfg)
 	apiObj.Run(constructPortString(cfg.APIPort))
 }
 
 func constructPortString(port int) string {
 	return fmt.Sprintf(":%d", port)
 }
+
+func newDatabase(storeType string, cfg *config.Config) (store.Database, error) {
+	switch storeType {
+	case "postgres":
+		return postgres.NewPostgresDB(cfg.PostgresURL)
+	case "memory":
+		return memory.NewMemoryDB(), nil
+	default:
+		return nil, fmt.Errorf("unknown store type %q", storeType)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"avtest/internal/config"
+	"avtest/internal/store/postgres"
+)
+
+var errMigrateUsage = errors.New("usage: migrate up | down [steps] | to <version> | status")
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	db, err := postgres.Connect(cfg.PostgresURL)
+	if err != nil {
+		return fmt.Errorf("failed to init db connection: %w", err)
+	}
+	defer db.DB.Close()
+
+	switch args[0] {
+	case "up":
+		err = db.MigrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+		err = db.MigrateDown(steps)
+	case "to":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil {
+			return errMigrateUsage
+		}
+		err = db.MigrateTo(version)
+	case "status":
+		return printMigrationStatus(db)
+	default:
+		return errMigrateUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(db)
+}
+
+func printMigrationStatus(db *postgres.PostgresDB) error {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return nil
+}
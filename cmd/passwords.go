@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"avtest/internal/config"
+	"avtest/internal/password"
+	"avtest/internal/store"
+	"avtest/internal/store/postgres"
+)
+
+// runHashPasswords implements the "hash-passwords" subcommand. It replaces
+// plaintext passwords left from before hashing was introduced. Rows that
+// already hold a hash are skipped, so it is safe to run more than once.
+func runHashPasswords(cfg *config.Config) error {
+	hasher, err := password.NewHasher(cfg.PasswordHashCost)
+	if err != nil {
+		return err
+	}
+
+	db, err := postgres.NewPostgresDB(cfg.PostgresURL)
+	if err != nil {
+		return fmt.Errorf("failed to init db connection: %w", err)
+	}
+	defer db.DB.Close()
+
+	ctx := store.WithAudit(context.Background(), store.AuditInfo{Role: store.RoleSystem})
+	users, err := db.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	var hashed int
+	for _, u := range users {
+		if password.IsHash(u.Password) {
+			continue
+		}
+
+		hash, err := hasher.Hash(u.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password of user %d: %w", u.ID, err)
+		}
+		if err := db.UpdateUserPassword(ctx, u.ID, hash); err != nil {
+			return fmt.Errorf("failed to update password of user %d: %w", u.ID, err)
+		}
+		hashed++
+	}
+
+	fmt.Printf("hashed %d of %d passwords\n", hashed, len(users))
+	return nil
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 500
+
+	// tempPasswordSize is the number of random bytes in the passwords set by
+	// a reset. The user gets the password from the admin.
+	tempPasswordSize = 16
+)
+
+// usersPage is a page of users, in id order. NextCursor is set when there
+// may be more users.
+type usersPage struct {
+	Users      []store.UserProfile `json:"users"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+type userCursor struct {
+	ID int64 `json:"id"`
+}
+
+// userUpdateRequest changes the role of a user and/or disables or enables
+// their account.
+type userUpdateRequest struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+type invitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// invitationResponse holds the only copy of the invitation token, to be
+// passed on to the invited person.
+type invitationResponse struct {
+	store.Invitation
+	Token string `json:"token"`
+}
+
+// listUsersHandler lets admins search the accounts.
+func (a *API) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseUserQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// One user more than asked tells whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+	users, err := a.db.SearchUsers(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := usersPage{Users: []store.UserProfile{}}
+	if len(users) > limit {
+		users = users[:limit]
+		page.NextCursor = encodeCursor(userCursor{ID: users[limit-1].ID})
+	}
+	for _, u := range users {
+		page.Users = append(page.Users, u.Profile())
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseUserQuery reads the user search parameters: email (a part of it),
+// role, disabled, limit and cursor.
+func parseUserQuery(values url.Values) (store.UserQuery, error) {
+	query := store.UserQuery{
+		Email: values.Get("email"),
+		Role:  values.Get("role"),
+		Limit: defaultUsersLimit,
+	}
+	if query.Role != "" && !slices.Contains(userTypes, query.Role) {
+		return query, fmt.Errorf("%w: role", errInvalidUserQuery)
+	}
+
+	if v := values.Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("%w: disabled", errInvalidUserQuery)
+		}
+		query.Disabled = &disabled
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxUsersLimit {
+			return query, fmt.Errorf("%w: limit", errInvalidUserQuery)
+		}
+		query.Limit = n
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		var c userCursor
+		if err := decodeCursor(v, &c); err != nil {
+			return query, err
+		}
+		query.AfterID = c.ID
+	}
+	return query, nil
+}
+
+// updateUserHandler changes the role of a user or disables their account.
+// Either ends the sessions of the user, so that their tokens don't keep the
+// old role.
+func (a *API) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse user id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var req userUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Role == nil && req.Disabled == nil {
+		http.Error(w, errEmptyUserUpdate.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Role != nil && !slices.Contains(userTypes, *req.Role) {
+		http.Error(w, errInvalidUserType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// An admin locking themselves out could leave the service without one.
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if p.Subject == strconv.FormatInt(id, 10) {
+		http.Error(w, errOwnAccount.Error(), http.StatusConflict)
+		return
+	}
+
+	u, err := a.db.UpdateUser(r.Context(), store.UserUpdate{
+		ID:       id,
+		Role:     req.Role,
+		Disabled: req.Disabled,
+		At:       time.Now(),
+	})
+	if errors.Is(err, store.ErrUserNotFound) {
+		http.Error(w, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.endSessions(r.Context(), u); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(u.Profile())
+}
+
+// resetPasswordHandler sets a new random password for the user and returns
+// it to the admin. The sessions of the user end.
+func (a *API) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse user id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	plain, err := randomString(tempPasswordSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hash, err := a.hasher.Hash(plain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.db.UpdateUser(r.Context(), store.UserUpdate{ID: id, Password: &hash, At: time.Now()})
+	if errors.Is(err, store.ErrUserNotFound) {
+		http.Error(w, errUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.endSessions(r.Context(), u); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"password": plain})
+}
+
+// endSessions revokes every refresh and access token of the user.
+func (a *API) endSessions(ctx context.Context, u *store.User) error {
+	subject := strconv.FormatInt(u.ID, 10)
+	if err := a.db.RevokeSubjectRefreshTokens(ctx, subject); err != nil {
+		return err
+	}
+	return a.db.RevokeSubjectTokens(ctx, subject, time.Now())
+}
+
+// createInvitationHandler invites someone to register as a moderator or an
+// admin. The role defaults to moderator.
+func (a *API) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var req invitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		http.Error(w, errEmailRequired.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Role == "" {
+		req.Role = Moderator
+	}
+	if !slices.Contains(invitedUserTypes, req.Role) {
+		http.Error(w, errInvalidUserType.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.db.GetUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if u != nil {
+		http.Error(w, errUserExists.Error(), http.StatusConflict)
+		return
+	}
+
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	token, inv, err := a.newInvitation(req.Email, req.Role, p.Subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.db.CreateInvitation(r.Context(), inv); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitationResponse{Invitation: *inv, Token: token})
+}
+
+// newInvitation generates an invitation token and the record to store for
+// it.
+func (a *API) newInvitation(email, role, createdBy string) (string, *store.Invitation, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	return token, &store.Invitation{
+		TokenHash: hashRefreshToken(token),
+		Email:     email,
+		Role:      role,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.invitationTTL),
+	}, nil
+}
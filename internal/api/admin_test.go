@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminUsers(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+	admin := registerAndLogin(t, testAPI, "admin@mail.ru", Admin)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+
+	// Only clients register without an invitation.
+	rec := doRequest(t, testAPI, http.MethodPost, "/register", "", map[string]string{
+		"email": "self@mail.ru", "password": "testpass", "type": Moderator,
+	})
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	for _, role := range []string{Moderator, Admin} {
+		rec = doRequest(t, testAPI, http.MethodPost, "/dummyLogin", "", map[string]string{"type": role})
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	}
+	rec = doRequest(t, testAPI, http.MethodPost, "/dummyLogin", "", map[string]string{"type": Client})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/admin/users", moderator.Token, nil)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	// An invitation is good for its email only, and only once.
+	rec = doRequest(t, testAPI, http.MethodPost, "/admin/invitations", admin.Token, map[string]string{"email": "new@mail.ru"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var inv invitationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&inv))
+	require.Equal(t, Moderator, inv.Role)
+	require.NotEmpty(t, inv.Token)
+	register := func(email string) int {
+		rec := doRequest(t, testAPI, http.MethodPost, "/register", "", map[string]string{
+			"email": email, "password": "testpass", "invitation": inv.Token,
+		})
+		return rec.Code
+	}
+	require.Equal(t, http.StatusForbidden, register("other@mail.ru"))
+	require.Equal(t, http.StatusOK, register("new@mail.ru"))
+	require.Equal(t, http.StatusForbidden, register("other@mail.ru"))
+
+	list := func(query string) usersPage {
+		t.Helper()
+		rec := doRequest(t, testAPI, http.MethodGet, "/admin/users"+query, admin.Token, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var page usersPage
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		return page
+	}
+	page := list("?role=moderator")
+	require.Len(t, page.Users, 2)
+	require.Equal(t, "new@mail.ru", page.Users[1].Email)
+	page = list("?email=MAIL.RU&limit=3")
+	require.Len(t, page.Users, 3)
+	require.NotEmpty(t, page.NextCursor)
+	page = list("?email=MAIL.RU&limit=3&cursor=" + page.NextCursor)
+	require.Len(t, page.Users, 1)
+	require.Empty(t, page.NextCursor)
+	clientID := list("?email=client").Users[0].ID
+	clientPath := "/admin/users/" + strconv.FormatInt(clientID, 10)
+
+	// Admins can't lock themselves out.
+	rec = doRequest(t, testAPI, http.MethodPatch, "/admin/users/1", admin.Token, map[string]bool{"disabled": true})
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// A disabled account can't log in or refresh its tokens.
+	rec = doRequest(t, testAPI, http.MethodPatch, clientPath, admin.Token, map[string]bool{"disabled": true})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var profile store.UserProfile
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&profile))
+	require.NotNil(t, profile.DisabledAt)
+	rec = doRequest(t, testAPI, http.MethodPost, "/login", "", map[string]string{"email": "client@mail.ru", "password": "testpass"})
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: client.RefreshToken})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Len(t, list("?disabled=true").Users, 1)
+
+	rec = doRequest(t, testAPI, http.MethodPatch, clientPath, admin.Token, map[string]any{"disabled": false, "role": Moderator})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var promoted store.UserProfile
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&promoted))
+	require.Nil(t, promoted.DisabledAt)
+	require.Equal(t, Moderator, promoted.Role)
+
+	// A reset replaces the password with the one handed to the admin.
+	rec = doRequest(t, testAPI, http.MethodPost, clientPath+"/password", admin.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var reset map[string]string
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&reset))
+	rec = doRequest(t, testAPI, http.MethodPost, "/login", "", map[string]string{"email": "client@mail.ru", "password": "testpass"})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequest(t, testAPI, http.MethodPost, "/login", "", map[string]string{"email": "client@mail.ru", "password": reset["password"]})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/admin/users/99/password", admin.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Admin changes are audited without the password hashes.
+	rec = doRequest(t, testAPI, http.MethodGet, "/audit?action="+store.AuditUserPasswordReset, admin.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var audit auditPage
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&audit))
+	require.Len(t, audit.Events, 1)
+	require.Equal(t, "1", audit.Events[0].Actor)
+	require.Equal(t, Admin, audit.Events[0].Role)
+	require.NotContains(t, string(audit.Events[0].After), "password")
+}
+
+func TestAdminSeesWhatClientsSee(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	admin := registerAndLogin(t, testAPI, "admin@mail.ru", Admin)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusApproved}))
+
+	flats := getFlats(t, testAPI, admin.Token, "/house/1")
+	require.Len(t, flats, 1)
+	require.Equal(t, int64(2), flats[0].FlatNumber)
+
+	rec := doRequest(t, testAPI, http.MethodGet, "/house/1?status=created", admin.Token, nil)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequest(t, testAPI, http.MethodGet, "/flat/1/1/prices", admin.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, testAPI, http.MethodGet, "/flat/1/1/moderation", admin.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
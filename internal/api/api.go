@@ -1,17 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"slices"
 	"strconv"
-	"strings"
-	"sync"
 	"time"
 
+	"avtest/internal/config"
+	"avtest/internal/events"
+	"avtest/internal/keys"
+	"avtest/internal/password"
 	"avtest/internal/store"
 
 	"github.com/gorilla/handlers"
@@ -20,62 +22,161 @@ import (
 )
 
 const (
-	Client    = "client"
-	Moderator = "moderator"
+	Client    = store.RoleClient
+	Moderator = store.RoleModerator
+	Admin     = store.RoleAdmin
 )
 
 var (
-	lock      sync.Mutex
-	jwtKey    = []byte("secret-key")
-	statuses  = []string{"on moderation", "approved", "declined"}
-	userTypes = []string{Client, Moderator}
-
-	errFailedToUpdateFlat   = errors.New("another moderator has already been assigned to this flat")
-	errInvalidSigningMethod = errors.New("unexpected signing method")
-	errInvalidToken         = errors.New("invalid token")
-	errInvalidUserType      = errors.New("invalid user type")
-	errFailedToGenerateJWT  = errors.New("failed to generate jwt")
-	errUserExists           = errors.New("user already exists")
-	errNonExistentUser      = errors.New("user doesn't exists")
-	errFailedToCheckToken   = errors.New("failed to check token")
-	errUnauthorized         = errors.New("not authorized")
-	errFailedToSubscribe    = errors.New("subscribe for clients only")
-	errWhongStatus          = errors.New("wrong status for the flat")
+	userTypes = []string{Client, Moderator, Admin}
+	// dummyUserTypes are the roles /dummyLogin hands out. Moderator and
+	// admin tokens are only issued to accounts made by invitation.
+	dummyUserTypes = []string{Client}
+	// invitedUserTypes are the roles that can only be had by invitation.
+	invitedUserTypes = []string{Moderator, Admin}
+
+	errInvalidToken        = errors.New("invalid token")
+	errInvalidUserType     = errors.New("invalid user type")
+	errFailedToGenerateJWT = errors.New("failed to generate jwt")
+	errUserExists          = errors.New("user already exists")
+	errInvalidCredentials  = errors.New("invalid email or password")
+	errEmptyPassword       = errors.New("password is required")
+	errFailedToCheckToken  = errors.New("failed to check token")
+	errUnauthorized        = errors.New("not authorized")
+	errForbidden           = errors.New("forbidden")
+	errTokenRevoked        = errors.New("token has been revoked")
+	errInvalidRefreshToken = errors.New("invalid refresh token")
+	errInvalidQueueFilter  = errors.New("invalid moderation queue filter")
+	errEmailRequired       = errors.New("email is required")
+	errInvalidWebhookURL   = errors.New("webhook url must be an absolute http or https url")
+	errInvalidEventType    = errors.New("invalid event type")
+	errInvalidIfMatch      = errors.New("If-Match must be \"*\" or a single entity tag")
+	errInvalidFlatQuery    = errors.New("invalid flat query")
+	errInvalidCursor       = errors.New("invalid cursor")
+	errInvalidHouseQuery   = errors.New("invalid house query")
+	errInvalidHouse        = errors.New("invalid house")
+	errInvalidFlat         = errors.New("invalid flat")
+	errInvalidAuditQuery   = errors.New("invalid audit query")
+	errInvalidDecision     = errors.New("invalid moderation decision")
+	errInvalidUserQuery    = errors.New("invalid user query")
+	errUserNotFound        = errors.New("user not found")
+	errAccountDisabled     = errors.New("account is disabled")
+	errInvitationRequired  = errors.New("only clients can register without an invitation")
+	errOwnAccount          = errors.New("admins can't change their own role or disable themselves")
+	errEmptyUserUpdate     = errors.New("role or disabled is required")
+
+	errStatusFilterForbidden = errors.New("only moderators can filter flats by status")
 )
 
-type Claims struct {
-	Role string
-	jwt.StandardClaims
-}
-
 type API struct {
 	logger *zap.Logger
 	r      *mux.Router
 	db     store.Database
+	hasher *password.Hasher
+	keys   *keys.Manager
+	broker events.Broker
+
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	invitationTTL   time.Duration
+	moderationLease time.Duration
+	declineReasons  map[string]string
+
+	queryTimeout       time.Duration
+	routeQueryTimeouts map[string]time.Duration
+
+	heartbeatInterval time.Duration
 }
 
-func NewAPI(logger *zap.Logger, r *mux.Router, db store.Database) *API {
+func NewAPI(logger *zap.Logger, r *mux.Router, db store.Database, hasher *password.Hasher,
+	keyManager *keys.Manager, broker events.Broker, cfg *config.Config) *API {
 	return &API{
-		logger: logger,
-		r:      r,
-		db:     db,
+		logger:          logger,
+		r:               r,
+		db:              db,
+		hasher:          hasher,
+		keys:            keyManager,
+		broker:          broker,
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+		invitationTTL:   cfg.InvitationTTL,
+		moderationLease: cfg.ModerationLease,
+		declineReasons:  cfg.DeclineReasons,
+
+		queryTimeout:       cfg.QueryTimeout,
+		routeQueryTimeouts: cfg.RouteQueryTimeouts,
+
+		heartbeatInterval: cfg.SSEHeartbeatInterval,
 	}
 }
 
 func (a *API) Run(apiPort string) {
-	a.r.HandleFunc("/dummyLogin", a.dummyLoginHandler).Methods("POST")
-	a.r.HandleFunc("/register", a.registerHandler).Methods("POST")
-	a.r.HandleFunc("/login", a.loginHandler).Methods("POST")
-	a.r.HandleFunc("/house/create", a.createHouseHandler).Methods("POST")
-	a.r.HandleFunc("/flat/create", a.createFlatHandler).Methods("POST")
-	a.r.HandleFunc("/flat/update", a.updateFlatHandler).Methods("POST")
-	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}", a.getFlatsByHouseHandler).Methods("GET")
-	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}/subscribe", a.subscribeHandler).Methods("POST")
+	a.registerRoutes()
 
 	http.Handle("/", handlers.CORS(handlers.AllowedOrigins([]string{"*"}))(a.r))
 	http.ListenAndServe(apiPort, nil)
 }
 
+func (a *API) registerRoutes() {
+	a.r.Use(a.requestID)
+	a.r.Use(a.limitQueries)
+	a.r.Use(a.authenticate)
+
+	a.r.HandleFunc("/.well-known/jwks.json", a.jwksHandler).Methods("GET").Name("jwks")
+	a.r.HandleFunc("/dummyLogin", a.dummyLoginHandler).Methods("POST").Name("dummy_login")
+	a.r.HandleFunc("/register", a.registerHandler).Methods("POST").Name("register")
+	a.r.HandleFunc("/login", a.loginHandler).Methods("POST").Name("login")
+	a.r.HandleFunc("/token/refresh", a.refreshTokenHandler).Methods("POST").Name("token.refresh")
+	a.r.HandleFunc("/logout", requireAuth(a.logoutHandler)).Methods("POST").Name("logout")
+	a.r.HandleFunc("/logout/all", requireAuth(a.logoutAllHandler)).Methods("POST").Name("logout.all")
+	a.r.HandleFunc("/house/create", requireRole(Moderator)(a.createHouseHandler)).Methods("POST").Name("house.create")
+	a.r.HandleFunc("/flat/create", requireAuth(a.createFlatHandler)).Methods("POST").Name("flat.create")
+	a.r.HandleFunc("/flat/update", requireRole(Moderator)(a.updateFlatHandler)).Methods("POST").Name("flat.update")
+	a.r.HandleFunc("/flat/{house:[0-9]+}/{flat:[0-9]+}",
+		requireAuth(a.editFlatHandler)).Methods("PATCH").Name("flat.edit")
+	a.r.HandleFunc("/flat/{house:[0-9]+}/{flat:[0-9]+}",
+		requireAuth(a.archiveFlatHandler)).Methods("DELETE").Name("flat.archive")
+	a.r.HandleFunc("/flat/{house:[0-9]+}/{flat:[0-9]+}/prices",
+		requireAuth(a.flatPricesHandler)).Methods("GET").Name("flat.prices")
+	a.r.HandleFunc("/flat/{house:[0-9]+}/{flat:[0-9]+}/moderation",
+		requireAuth(a.flatModerationHandler)).Methods("GET").Name("flat.moderation")
+	a.r.HandleFunc("/flat/lease/heartbeat",
+		requireRole(Moderator)(a.leaseHeartbeatHandler)).Methods("POST").Name("flat.lease.heartbeat")
+	a.r.HandleFunc("/flat/lease/release",
+		requireRole(Admin)(a.releaseLeaseHandler)).Methods("POST").Name("flat.lease.release")
+	a.r.HandleFunc("/moderation/next", requireRole(Moderator)(a.nextFlatHandler)).Methods("GET").Name("moderation.next")
+	a.r.HandleFunc("/moderation/queue",
+		requireRole(Moderator)(a.moderationQueueHandler)).Methods("GET").Name("moderation.queue")
+	a.r.HandleFunc("/webhooks", requireRole(Moderator)(a.createWebhookHandler)).Methods("POST").Name("webhooks.create")
+	a.r.HandleFunc("/webhooks", requireRole(Moderator)(a.listWebhooksHandler)).Methods("GET").Name("webhooks.list")
+	a.r.HandleFunc("/webhooks/{id:[0-9]+}",
+		requireRole(Moderator)(a.deleteWebhookHandler)).Methods("DELETE").Name("webhooks.delete")
+	a.r.HandleFunc("/webhooks/{id:[0-9]+}/deliveries",
+		requireRole(Moderator)(a.listWebhookDeliveriesHandler)).Methods("GET").Name("webhooks.deliveries")
+	a.r.HandleFunc("/webhooks/{id:[0-9]+}/deliveries/{delivery_id:[0-9]+}/replay",
+		requireRole(Moderator)(a.replayWebhookDeliveryHandler)).Methods("POST").Name("webhooks.replay")
+	a.r.HandleFunc("/houses", requireAuth(a.listHousesHandler)).Methods("GET").Name("houses.list")
+	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}", requireAuth(a.getFlatsByHouseHandler)).Methods("GET").Name("house.flats")
+	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}",
+		requireRole(Moderator)(a.updateHouseHandler)).Methods("PUT", "PATCH").Name("house.update")
+	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}",
+		requireRole(Moderator)(a.deleteHouseHandler)).Methods("DELETE").Name("house.delete")
+	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}/events",
+		requireAuth(a.houseEventsHandler)).Methods("GET").Name(routeHouseEvents)
+	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}/subscribe",
+		requireRole(Client)(a.subscribeHandler)).Methods("POST").Name("house.subscribe")
+	a.r.HandleFunc("/house/{id:[a-zA-Z0-9]+}/subscribe",
+		requireRole(Client)(a.unsubscribeHandler)).Methods("DELETE").Name("house.unsubscribe")
+	a.r.HandleFunc("/audit", requireRole(Moderator, Admin)(a.listAuditHandler)).Methods("GET").Name("audit.list")
+	a.r.HandleFunc("/admin/users", requireRole(Admin)(a.listUsersHandler)).Methods("GET").Name("admin.users.list")
+	a.r.HandleFunc("/admin/users/{id:[0-9]+}",
+		requireRole(Admin)(a.updateUserHandler)).Methods("PATCH").Name("admin.users.update")
+	a.r.HandleFunc("/admin/users/{id:[0-9]+}/password",
+		requireRole(Admin)(a.resetPasswordHandler)).Methods("POST").Name("admin.users.reset_password")
+	a.r.HandleFunc("/admin/invitations",
+		requireRole(Admin)(a.createInvitationHandler)).Methods("POST").Name("admin.invitations.create")
+}
+
 func (a *API) dummyLoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req *store.User
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -84,12 +185,12 @@ func (a *API) dummyLoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userType := req.Type
-	if !slices.Contains(userTypes, userType) {
+	if !slices.Contains(dummyUserTypes, userType) {
 		http.Error(w, errInvalidUserType.Error(), http.StatusBadRequest)
 		return
 	}
 
-	token, err := generateToken(userType)
+	token, err := a.generateToken("", req.Email, userType)
 	if err != nil {
 		http.Error(w, errFailedToGenerateJWT.Error(), http.StatusBadRequest)
 		return
@@ -98,17 +199,23 @@ func (a *API) dummyLoginHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
 
+// registerRequest signs up a client, or a moderator or an admin holding an
+// invitation. The invitation decides the role.
+type registerRequest struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Type       string `json:"type"`
+	Invitation string `json:"invitation"`
+}
+
 func (a *API) registerHandler(w http.ResponseWriter, r *http.Request) {
-	var req *store.User
+	var req registerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-
-	u, err := a.db.GetUserByEmail(req.Email)
+	u, err := a.db.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -118,7 +225,35 @@ func (a *API) registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.db.CreateUser(req)
+	if req.Password == "" {
+		http.Error(w, errEmptyPassword.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Invitation == "" && req.Type != "" && req.Type != Client {
+		http.Error(w, errInvitationRequired.Error(), http.StatusForbidden)
+		return
+	}
+	hash, err := a.hasher.Hash(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := &store.User{Email: req.Email, Password: hash, Type: Client}
+	if req.Invitation == "" {
+		err = a.db.CreateUser(r.Context(), user)
+	} else {
+		// Invitation tokens are stored hashed like refresh tokens.
+		err = a.db.AcceptInvitation(r.Context(), hashRefreshToken(req.Invitation), user, time.Now())
+	}
+	if errors.Is(err, store.ErrInvitationInvalid) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, store.ErrUserExists) {
+		http.Error(w, errUserExists.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -135,74 +270,74 @@ func (a *API) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-
-	u, err := a.db.GetUserByEmail(req.Email)
+	u, err := a.db.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	if u == nil {
-		http.Error(w, errNonExistentUser.Error(), http.StatusNotFound)
+		a.hasher.VerifyDummy(req.Password)
+		http.Error(w, errInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !a.hasher.Verify(u.Password, req.Password) {
+		http.Error(w, errInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+	if u.DisabledAt != nil {
+		http.Error(w, errAccountDisabled.Error(), http.StatusForbidden)
 		return
 	}
 
-	token, err := generateToken(u.Type)
+	ctx := asUser(r.Context(), u)
+	if a.hasher.NeedsRehash(u.Password) {
+		a.rehashPassword(ctx, u, req.Password)
+	}
+
+	tokens, err := a.issueTokens(ctx, u)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(tokens)
 }
 
-func (a *API) createHouseHandler(w http.ResponseWriter, r *http.Request) {
-	bearerToken := r.Header.Get("Authorization")
-	err := checkModerator(bearerToken)
+// rehashPassword upgrades the stored hash after the hashing parameters change.
+// A failure only means the upgrade is retried on the next login.
+func (a *API) rehashPassword(ctx context.Context, u *store.User, plain string) {
+	hash, err := a.hasher.Hash(plain)
+	if err == nil {
+		err = a.db.UpdateUserPassword(ctx, u.ID, hash)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
+		a.logger.Warn("failed to rehash password", zap.Int64("user_id", u.ID), zap.Error(err))
 	}
+}
 
+func (a *API) createHouseHandler(w http.ResponseWriter, r *http.Request) {
 	var req *store.House
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-
 	req.CreatedAt = time.Now()
 
-	err = a.db.CreateHouse(req)
+	err := a.db.CreateHouse(r.Context(), req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	setETag(w, req.Version)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(req)
 }
 
-func checkModerator(bearerToken string) error {
-	tokenString := getCorrectToken(bearerToken)
-	token, err := checkToken(tokenString)
-	if err != nil {
-		return fmt.Errorf("failed to check token: %w", err)
-	}
-
-	claims, ok := token.Claims.(*Claims)
-	if !ok || claims.Role != "moderator" {
-		return fmt.Errorf("not authorized")
-	}
-	return nil
-}
-
 func (a *API) createFlatHandler(w http.ResponseWriter, r *http.Request) {
-	bearerToken := r.Header.Get("Authorization")
-	err := checkModerator(bearerToken)
+	p, err := principalFrom(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
@@ -214,95 +349,89 @@ func (a *API) createFlatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-
-	req.Status = "created"
+	req.Owner = p.Subject
+	req.Status = store.StatusCreated
+	req.CreatedAt = time.Now()
 
-	err = a.db.CreateFlat(req)
+	err = a.db.CreateFlat(r.Context(), req)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = a.db.UpdateHouseFlatTime(time.Now())
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-	}
-
+	setETag(w, req.Version)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(req)
 }
 
 func (a *API) updateFlatHandler(w http.ResponseWriter, r *http.Request) {
-	bearerToken := r.Header.Get("Authorization")
-	tokenString := getCorrectToken(bearerToken)
-	err := checkModerator(bearerToken)
+	p, err := principalFrom(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
 
-	var req *store.Flat
+	var req *flatStatusRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	lock.Lock()
-	defer lock.Unlock()
-
-	f, err := a.db.GetFlatStatus(req.HouseNumber, req.FlatNumber)
-	if err != nil {
+	if err := a.validateDecision(req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	curStatus := f.Status
-	if curStatus == "on moderation" && f.Moderator != tokenString {
-		http.Error(w, errFailedToUpdateFlat.Error(), http.StatusBadRequest)
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if !slices.Contains(statuses, req.Status) {
-		http.Error(w, errWhongStatus.Error(), http.StatusBadRequest)
-		return
-	}
+	now := time.Now()
+	change := store.FlatStatusChange{
+		HouseNumber: req.HouseNumber,
+		FlatNumber:  req.FlatNumber,
+		Status:      req.Status,
+		Actor:       p.Subject,
+		Role:        p.Role,
+		At:          now,
 
-	err = a.db.UpdateFlat(req, tokenString)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		ExpectedVersion: expectedVersion,
+
+		Reason:  req.Reason,
+		Comment: req.Comment,
+	}
+	if req.Status == store.StatusOnModeration {
+		leaseExpiresAt := now.Add(a.moderationLease)
+		change.ModerationStartedAt, change.LeaseExpiresAt = &now, &leaseExpiresAt
 	}
 
-	flat, err := a.db.GetFlat(req.HouseNumber, req.FlatNumber)
+	flat, err := a.db.ChangeFlatStatus(r.Context(), change)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), transitionErrorStatus(err))
 		return
 	}
 
+	setETag(w, flat.Version)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(flat)
 }
 
 func (a *API) getFlatsByHouseHandler(w http.ResponseWriter, r *http.Request) {
 	houseID := mux.Vars(r)["id"]
-	bearerToken := r.Header.Get("Authorization")
-	tokenString := getCorrectToken(bearerToken)
-	userType, err := getUserType(tokenString)
+	p, err := principalFrom(r.Context())
 	if err != nil {
-		http.Error(w, "failed to get user type", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
 	}
 
-	lock.Lock()
-	defer lock.Unlock()
-
-	id, err := strconv.ParseInt(houseID, 10, 2)
+	id, err := strconv.ParseInt(houseID, 10, 64)
 	if err != nil {
-		log.Fatalf("failed to parse int: %s", err)
+		http.Error(w, fmt.Sprintf("failed to parse house id: %s", err), http.StatusBadRequest)
+		return
 	}
 
-	h, err := a.db.GetHouseByID(id)
+	h, err := a.db.GetHouseByID(r.Context(), id)
 	if err != nil {
 		http.Error(w, "Flat not found", http.StatusNotFound)
 		return
@@ -312,83 +441,47 @@ func (a *API) getFlatsByHouseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	flats, err := a.db.GetFlatsByHouseID(id, userType)
-	if err != nil {
-		http.Error(w, "Flats not found", http.StatusNotFound)
+	query, err := parseFlatQuery(r.URL.Query(), p.Role)
+	if errors.Is(err, errStatusFilterForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(flats)
-}
-
-func (a *API) subscribeHandler(w http.ResponseWriter, r *http.Request) {
-	bearerToken := r.Header.Get("Authorization")
-	tokenString := getCorrectToken(bearerToken)
-	userType, err := getUserType(tokenString)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if userType != "client" {
-		http.Error(w, errFailedToSubscribe.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Subscribed successfully"})
-}
-
-// generateToken generates a token based on the user type.
-func generateToken(role string) (string, error) {
-	expirationTime := time.Now().Add(72 * time.Hour)
 
-	tokenClaims := &Claims{
-		Role: role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// One flat more than asked tells whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+	flats, err := a.db.GetFlatsByHouseID(r.Context(), id, query)
+	if err != nil {
+		http.Error(w, "Flats not found", http.StatusNotFound)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims)
-	return token.SignedString(jwtKey)
-}
-
-// checkToken checks whether the token meets the requirements.
-func checkToken(tokenString string) (*jwt.Token, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, fmt.Errorf("%w: %v", errInvalidSigningMethod, err)
+	if len(flats) > limit {
+		flats = flats[:limit]
+		w.Header().Set(nextCursorHeader, encodeFlatCursor(query, flats[limit-1]))
 	}
-	if err != nil || !token.Valid {
-		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	if flats == nil {
+		flats = []store.Flat{}
 	}
-	return token, nil
-}
 
-// getCorrectToken converts the token to the correct form.
-func getCorrectToken(token string) string {
-	splitToken := strings.Split(token, " ")
-	var correctToken string
-	if len(splitToken) == 2 {
-		correctToken = splitToken[1]
-	}
-	return correctToken
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(flats)
 }
 
-// getUserType returns the user type encrypted in the token.
-func getUserType(tokenString string) (string, error) {
-	token, err := checkToken(tokenString)
-	if err != nil {
-		return "", fmt.Errorf("%w: %v", errFailedToCheckToken, err)
-	}
-
-	tokenClaims, ok := token.Claims.(*Claims)
-	if !ok {
-		return "", fmt.Errorf("%w: %v", errUnauthorized, err)
+// transitionErrorStatus maps a failed flat status change to a response code.
+func transitionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrTransitionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrIllegalTransition), errors.Is(err, store.ErrLeaseExpired):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusBadRequest
 	}
-
-	return tokenClaims.Role, nil
 }
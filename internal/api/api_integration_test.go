@@ -1,14 +1,26 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"avtest/internal/config"
+	"avtest/internal/events"
+	"avtest/internal/keys"
+	"avtest/internal/password"
 	"avtest/internal/store"
+	"avtest/internal/store/memory"
 	"avtest/internal/store/postgres"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -21,6 +33,138 @@ func TestGoMigrationsPG(t *testing.T) {
 	runMigrations(t, dsn)
 }
 
+func TestStoreScenarioMemory(t *testing.T) {
+	runScenario(t, memory.NewMemoryDB())
+}
+
+func TestHandlersMemory(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/register", "", map[string]string{
+		"email":      "moderator@mail.ru",
+		"password":   "testpass",
+		"type":       Moderator,
+		"invitation": invite(t, testAPI, "moderator@mail.ru", Moderator),
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/register", "", map[string]string{
+		"email":    "moderator@mail.ru",
+		"password": "testpass",
+		"type":     Moderator,
+	})
+	require.NotEqual(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/login", "", map[string]string{
+		"email":    "moderator@mail.ru",
+		"password": "wrongpass",
+	})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/login", "", map[string]string{
+		"email":    "unknown@mail.ru",
+		"password": "testpass",
+	})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/login", "", map[string]string{
+		"email":    "moderator@mail.ru",
+		"password": "testpass",
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var loginResp map[string]string
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&loginResp))
+	moderatorToken := loginResp["token"]
+	require.NotEmpty(t, moderatorToken)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/house/create", moderatorToken, store.House{
+		HouseNumber: 1,
+		Address:     "test address",
+		YearBuilt:   2021,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/house/create", moderatorToken, store.House{
+		HouseNumber: 1,
+		Address:     "test address",
+		YearBuilt:   2021,
+	})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/create", moderatorToken, store.Flat{
+		HouseNumber: 2,
+		FlatNumber:  1,
+		Price:       100000,
+		Rooms:       2,
+	})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/create", moderatorToken, store.Flat{
+		HouseNumber: 1,
+		FlatNumber:  1,
+		Price:       100000,
+		Rooms:       2,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	clientToken, err := testAPI.generateToken("", "", Client)
+	require.NoError(t, err)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/house/create", clientToken, store.House{
+		HouseNumber: 2,
+		Address:     "test address",
+		YearBuilt:   2021,
+	})
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/house/1", "", nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	flats := getFlats(t, testAPI, clientToken, "/house/1")
+	require.Empty(t, flats)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", moderatorToken, store.Flat{
+		HouseNumber: 1,
+		FlatNumber:  1,
+		Status:      "approved",
+	})
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", moderatorToken, store.Flat{
+		HouseNumber: 1,
+		FlatNumber:  1,
+		Status:      "sold",
+	})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", moderatorToken, store.Flat{
+		HouseNumber: 1,
+		FlatNumber:  1,
+		Status:      "on moderation",
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	otherModeratorToken, err := testAPI.generateToken("", "", Moderator)
+	require.NoError(t, err)
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", otherModeratorToken, store.Flat{
+		HouseNumber: 1,
+		FlatNumber:  1,
+		Status:      "approved",
+	})
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", moderatorToken, store.Flat{
+		HouseNumber: 1,
+		FlatNumber:  1,
+		Status:      "approved",
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	flats = getFlats(t, testAPI, clientToken, "/house/1")
+	require.Len(t, flats, 1)
+	require.Equal(t, "approved", flats[0].Status)
+}
+
 func runMigrations(t *testing.T, dsn string) {
 	t.Helper()
 	db := setupTestDB(t, dsn)
@@ -29,13 +173,18 @@ func runMigrations(t *testing.T, dsn string) {
 		require.NoError(t, err, "db.Close()")
 	})
 
+	runScenario(t, db)
+}
+
+func runScenario(t *testing.T, db store.Database) {
+	ctx := context.Background()
+	t.Helper()
+
 	logger, err := zap.NewProduction()
 	require.NoError(t, err)
 	r := mux.NewRouter()
 
-	testAPI := &API{logger, r, db}
-	err = testAPI.db.CreateTable()
-	require.NoError(t, err)
+	testAPI := NewAPI(logger, r, db, newTestHasher(t), newTestKeys(t), events.NewMemoryBroker(), newTestConfig())
 
 	testModerator := &store.User{
 		Email:    "testuser@mail.ru",
@@ -43,7 +192,7 @@ func runMigrations(t *testing.T, dsn string) {
 		Type:     "moderator",
 	}
 
-	err = testAPI.db.CreateUser(testModerator)
+	err = testAPI.db.CreateUser(ctx, testModerator)
 	require.NoError(t, err)
 
 	testHouse := &store.House{
@@ -53,7 +202,7 @@ func runMigrations(t *testing.T, dsn string) {
 		Developer:   "test dev",
 	}
 
-	err = testAPI.db.CreateHouse(testHouse)
+	err = testAPI.db.CreateHouse(ctx, testHouse)
 	require.NoError(t, err)
 
 	testFlat := &store.Flat{
@@ -65,23 +214,105 @@ func runMigrations(t *testing.T, dsn string) {
 		Moderator:   "",
 	}
 
-	err = testAPI.db.CreateFlat(testFlat)
+	err = testAPI.db.CreateFlat(ctx, testFlat)
 	require.NoError(t, err)
 
-	testUpdateFlat := &store.Flat{
+	testUpdateFlat := store.FlatStatusChange{
 		HouseNumber: 1,
 		FlatNumber:  1,
 		Status:      "on moderation",
+		Actor:       "moderator1",
+		Role:        store.RoleModerator,
 	}
 
-	err = testAPI.db.UpdateFlat(testUpdateFlat, "token_moderator1")
+	_, err = testAPI.db.ChangeFlatStatus(ctx, testUpdateFlat)
 	require.NoError(t, err)
 
-	_, err = testAPI.db.GetFlatStatus(testUpdateFlat.HouseNumber, testUpdateFlat.FlatNumber)
+	_, err = testAPI.db.GetFlatStatus(ctx, testUpdateFlat.HouseNumber, testUpdateFlat.FlatNumber)
 	require.NoError(t, err)
 
 }
 
+func newTestAPI(t *testing.T, db store.Database) *API {
+	t.Helper()
+
+	testAPI := NewAPI(zap.NewNop(), mux.NewRouter(), db, newTestHasher(t), newTestKeys(t), events.NewMemoryBroker(), newTestConfig())
+	testAPI.registerRoutes()
+	return testAPI
+}
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: time.Hour,
+		InvitationTTL:   time.Hour,
+		ModerationLease: time.Hour,
+		DeclineReasons:  map[string]string{"wrong_price": "Wrong price", "duplicate": "Duplicate listing"},
+
+		OutboxBatchSize:      100,
+		OutboxPublishTimeout: time.Second,
+		OutboxMaxAttempts:    3,
+		OutboxRetryBackoff:   time.Second,
+
+		QueryTimeout: time.Minute,
+
+		SSEHeartbeatInterval: time.Hour,
+	}
+}
+
+func newTestKeys(t *testing.T) *keys.Manager {
+	t.Helper()
+
+	keyManager, err := keys.NewManager([]config.JWTKey{
+		{ID: "test", Algorithm: "HS256", Secret: "test-secret", Active: true},
+	})
+	require.NoError(t, err)
+	return keyManager
+}
+
+func newTestHasher(t *testing.T) *password.Hasher {
+	t.Helper()
+
+	hasher, err := password.NewHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+	return hasher
+}
+
+// doRequest serves the request with the token and body, if any, and the
+// extra headers.
+func doRequest(t *testing.T, a *API, method, target, token string, body any, headers ...http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+
+	req := httptest.NewRequest(method, target, &buf)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, h := range headers {
+		for key, values := range h {
+			req.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	rec := httptest.NewRecorder()
+	a.r.ServeHTTP(rec, req)
+	return rec
+}
+
+func getFlats(t *testing.T, a *API, token, target string) []store.Flat {
+	t.Helper()
+
+	rec := doRequest(t, a, http.MethodGet, target, token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var flats []store.Flat
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&flats))
+	return flats
+}
+
 func setupTestDB(t *testing.T, dsn string) *postgres.PostgresDB {
 	t.Helper()
 	if dsn == "" {
@@ -96,6 +327,9 @@ func setupTestDB(t *testing.T, dsn string) *postgres.PostgresDB {
 
 	resetPublicSchemaPG(t, db)
 
+	err = db.MigrateUp()
+	require.NoError(t, err, "db.MigrateUp() error")
+
 	return db
 }
 
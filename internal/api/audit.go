@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// auditPage is a page of the audit log, newest first. NextCursor is set
+// when there may be older records.
+type auditPage struct {
+	Events     []store.AuditRecord `json:"events"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+type auditCursor struct {
+	ID int64 `json:"id"`
+}
+
+// asUser returns a context whose writes are audited as made by the user, for
+// writes to their account before they hold a token.
+func asUser(ctx context.Context, u *store.User) context.Context {
+	info := store.AuditFrom(ctx)
+	info.Actor, info.Role = strconv.FormatInt(u.ID, 10), u.Type
+	return store.WithAudit(ctx, info)
+}
+
+// listAuditHandler serves the audit log to moderators.
+func (a *API) listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// One record more than asked tells whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	records, err := a.db.ListAuditRecords(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := auditPage{Events: records}
+	if len(records) > limit {
+		page.Events = records[:limit]
+		page.NextCursor = encodeCursor(auditCursor{ID: page.Events[limit-1].ID})
+	}
+	if page.Events == nil {
+		page.Events = []store.AuditRecord{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseAuditFilter reads the audit log parameters: actor, action, entity,
+// entity_id, request_id, from and to (RFC 3339, to excluded), limit and
+// cursor.
+func parseAuditFilter(values url.Values) (store.AuditFilter, error) {
+	filter := store.AuditFilter{
+		Actor:     values.Get("actor"),
+		Action:    values.Get("action"),
+		Entity:    values.Get("entity"),
+		EntityID:  values.Get("entity_id"),
+		RequestID: values.Get("request_id"),
+		Limit:     defaultAuditLimit,
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := values.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%w: %s", errInvalidAuditQuery, name)
+			}
+			*dst = t
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			return filter, fmt.Errorf("%w: limit", errInvalidAuditQuery)
+		}
+		filter.Limit = n
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		var c auditCursor
+		if err := decodeCursor(v, &c); err != nil {
+			return filter, err
+		}
+		filter.BeforeID = c.ID
+	}
+	return filter, nil
+}
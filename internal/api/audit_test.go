@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	// The request id of the client is kept and sent back.
+	rec := doRequest(t, testAPI, http.MethodPost, "/house/create", moderator.Token,
+		map[string]any{"house_number": 1, "address": "Lenina 1", "year_built": 1990},
+		http.Header{requestIDHeader: {"create-house-1"}})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, "create-house-1", rec.Header().Get(requestIDHeader))
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/create", client.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "price": 100000, "rooms": 2,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	flatRequestID := rec.Header().Get(requestIDHeader)
+	require.NotEmpty(t, flatRequestID)
+
+	list := func(token, query string) (int, auditPage) {
+		t.Helper()
+		rec := doRequest(t, testAPI, http.MethodGet, "/audit"+query, token, nil)
+		var page auditPage
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		}
+		return rec.Code, page
+	}
+
+	code, _ := list(client.Token, "")
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = list(moderator.Token, "?from=yesterday")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, page := list(moderator.Token, "?request_id=create-house-1")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 1)
+	record := page.Events[0]
+	require.Equal(t, store.AuditHouseCreated, record.Action)
+	require.Equal(t, store.AuditEntityHouse, record.Entity)
+	require.Equal(t, "1", record.EntityID)
+	require.Equal(t, "2", record.Actor)
+	require.Equal(t, Moderator, record.Role)
+	require.Nil(t, record.Before)
+	var house store.House
+	require.NoError(t, json.Unmarshal(record.After, &house))
+	require.Equal(t, "Lenina 1", house.Address)
+
+	code, page = list(moderator.Token, "?request_id="+flatRequestID)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 1)
+	require.Equal(t, store.AuditFlatCreated, page.Events[0].Action)
+	require.Equal(t, Client, page.Events[0].Role)
+
+	// Registration and login are recorded as made by the user.
+	code, page = list(moderator.Token, "?entity=user&entity_id=1")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 2)
+	require.Equal(t, store.AuditUserLoggedIn, page.Events[0].Action)
+	require.Equal(t, store.AuditUserRegistered, page.Events[1].Action)
+	require.Equal(t, "1", page.Events[1].Actor)
+	require.Equal(t, Client, page.Events[1].Role)
+
+	// Pages go from the newest record to the oldest.
+	code, page = list(moderator.Token, "?actor=2&limit=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 2)
+	require.Equal(t, store.AuditHouseCreated, page.Events[0].Action)
+	require.Equal(t, store.AuditUserLoggedIn, page.Events[1].Action)
+	require.NotEmpty(t, page.NextCursor)
+	code, page = list(moderator.Token, "?actor=2&limit=2&cursor="+page.NextCursor)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Events, 1)
+	require.Equal(t, store.AuditUserRegistered, page.Events[0].Action)
+	require.Empty(t, page.NextCursor)
+}
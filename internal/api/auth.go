@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	tokenIssuer   = "avtest"
+	tokenAudience = "avtest-api"
+
+	// dummySubjectPrefix marks principals issued by /dummyLogin, which
+	// are not backed by a row in the users table.
+	dummySubjectPrefix = "dummy-"
+)
+
+type Claims struct {
+	Role  string `json:"role"`
+	Email string `json:"email,omitempty"`
+	// IssuedAtMicro is iat in microseconds. Whole seconds can't tell a
+	// token issued right after a logout-all from one it revoked.
+	IssuedAtMicro int64 `json:"iat_us,omitempty"`
+	jwt.StandardClaims
+}
+
+// issuedAt returns the most precise issue time the token carries.
+func (c *Claims) issuedAt() time.Time {
+	if c.IssuedAtMicro != 0 {
+		return time.UnixMicro(c.IssuedAtMicro)
+	}
+	return time.Unix(c.IssuedAt, 0)
+}
+
+// Valid checks the standard claims and makes sure the token identifies
+// its holder and was issued for this service.
+func (c *Claims) Valid() error {
+	if err := c.StandardClaims.Valid(); err != nil {
+		return err
+	}
+
+	switch {
+	case c.ExpiresAt == 0:
+		return fmt.Errorf("%w: missing exp", errInvalidToken)
+	case c.Subject == "":
+		return fmt.Errorf("%w: missing sub", errInvalidToken)
+	case c.Id == "":
+		return fmt.Errorf("%w: missing jti", errInvalidToken)
+	case c.Role == "":
+		return fmt.Errorf("%w: missing role", errInvalidToken)
+	case !c.VerifyIssuer(tokenIssuer, true):
+		return fmt.Errorf("%w: unexpected issuer", errInvalidToken)
+	case !c.VerifyAudience(tokenAudience, true):
+		return fmt.Errorf("%w: unexpected audience", errInvalidToken)
+	}
+	return nil
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject   string
+	Email     string
+	Role      string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// UserID returns the users table id of the principal. Principals issued
+// by /dummyLogin have none.
+func (p *Principal) UserID() (int64, bool) {
+	id, err := strconv.ParseInt(p.Subject, 10, 64)
+	return id, err == nil
+}
+
+type principalKey struct{}
+
+type authResult struct {
+	principal *Principal
+	err       error
+}
+
+// authenticate parses the bearer token, if any, and puts the result into the
+// request context. It never rejects a request by itself: routes decide
+// whether they need a principal with requireAuth or requireRole.
+func (a *API) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := authResult{err: errUnauthorized}
+
+		if tokenString := getCorrectToken(r.Header.Get("Authorization")); tokenString != "" {
+			res.principal, res.err = a.authenticateToken(r.Context(), tokenString)
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, res)
+		if res.principal != nil {
+			info := store.AuditFrom(ctx)
+			info.Actor, info.Role = res.principal.Subject, res.principal.Role
+			ctx = store.WithAudit(ctx, info)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateToken validates the token and makes sure it hasn't been
+// revoked by a logout.
+func (a *API) authenticateToken(ctx context.Context, tokenString string) (*Principal, error) {
+	p, err := a.principalFromToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := a.db.IsAccessTokenRevoked(ctx, p.TokenID, p.Subject, p.IssuedAt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFailedToCheckToken, err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("%w: %v", errFailedToCheckToken, errTokenRevoked)
+	}
+	return p, nil
+}
+
+// principalFrom returns the principal authenticated for the request.
+func principalFrom(ctx context.Context) (*Principal, error) {
+	res, ok := ctx.Value(principalKey{}).(authResult)
+	if !ok {
+		return nil, errUnauthorized
+	}
+	return res.principal, res.err
+}
+
+// requireAuth rejects requests without a valid token.
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return requireRole()(next)
+}
+
+// requireRole rejects requests without a valid token or, when roles are
+// given, whose principal has none of them.
+func requireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p, err := principalFrom(r.Context())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if len(roles) > 0 && !hasRole(p, roles) {
+				http.Error(w, errForbidden.Error(), http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+func hasRole(p *Principal, roles []string) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// generateToken issues an access token for the given subject, signed with
+// the active key.
+func (a *API) generateToken(subject, email, role string) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	if subject == "" {
+		subject = dummySubjectPrefix + tokenID
+	}
+
+	now := time.Now()
+	tokenClaims := &Claims{
+		Role:          role,
+		Email:         email,
+		IssuedAtMicro: now.UnixMicro(),
+		StandardClaims: jwt.StandardClaims{
+			Subject:   subject,
+			Id:        tokenID,
+			Issuer:    tokenIssuer,
+			Audience:  tokenAudience,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(a.accessTokenTTL).Unix(),
+		},
+	}
+
+	return a.keys.Sign(tokenClaims)
+}
+
+// checkToken checks whether the token meets the requirements.
+func (a *API) checkToken(tokenString string) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, a.keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+	return token, nil
+}
+
+// principalFromToken validates the token and extracts its principal.
+func (a *API) principalFromToken(tokenString string) (*Principal, error) {
+	token, err := a.checkToken(tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFailedToCheckToken, err)
+	}
+
+	tokenClaims, ok := token.Claims.(*Claims)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	return &Principal{
+		Subject:   tokenClaims.Subject,
+		Email:     tokenClaims.Email,
+		Role:      tokenClaims.Role,
+		TokenID:   tokenClaims.Id,
+		IssuedAt:  tokenClaims.issuedAt(),
+		ExpiresAt: time.Unix(tokenClaims.ExpiresAt, 0),
+	}, nil
+}
+
+func (a *API) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.keys.JWKS())
+}
+
+// getCorrectToken converts the token to the correct form.
+func getCorrectToken(token string) string {
+	splitToken := strings.Split(token, " ")
+	var correctToken string
+	if len(splitToken) == 2 {
+		correctToken = splitToken[1]
+	}
+	return correctToken
+}
+
+// newTokenID returns a random identifier for the jti claim.
+func newTokenID() (string, error) {
+	return randomString(16)
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// encodeCursor turns a listing position into an opaque token for clients.
+func encodeCursor(v any) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a token made by encodeCursor.
+func decodeCursor(s string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errInvalidCursor
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errInvalidCursor
+	}
+	return nil
+}
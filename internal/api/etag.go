@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// setETag exposes the version of the returned record as its entity tag.
+func setETag(w http.ResponseWriter, version int64) {
+	if version > 0 {
+		w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+}
+
+// ifMatchVersion returns the version the client expects the record to be at,
+// or zero when the request is unconditional.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+
+	unquoted, err := strconv.Unquote(v)
+	if err != nil || !strings.HasPrefix(v, `"`) {
+		return 0, errInvalidIfMatch
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	// resumePageSize is how many stored events are read at a time when a
+	// client resumes a feed.
+	resumePageSize = 500
+
+	// sentEventsMemory is how many ids of sent events a stream remembers to
+	// skip repeats.
+	sentEventsMemory = 4096
+
+	// maxClockSkew allows for the clocks of replicas stamping events
+	// differently.
+	maxClockSkew = 5 * time.Second
+	// unlimitedWriteWindow stands in for the duration of writes without a
+	// query timeout.
+	unlimitedWriteWindow = time.Minute
+)
+
+// houseEventsHandler streams flat events of a house as Server-Sent Events.
+// Event ids are outbox ids, so a client that reconnects with Last-Event-ID
+// first gets what it missed from the outbox and then the live feed.
+//
+// Outbox ids are taken at insert, and concurrent writes commit in any order,
+// so an event may arrive after one with a higher id. Streams skip repeats by
+// the ids they have sent rather than by the highest one, and a resumed
+// stream first sends again the events created shortly before Last-Event-ID,
+// which may have been committed after it.
+func (a *API) houseEventsHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse house id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	resume := false
+	var lastID int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse Last-Event-ID: %s", err), http.StatusBadRequest)
+			return
+		}
+		resume = true
+	}
+
+	ctx, cancel := a.queryContext(r.Context(), routeHouseEvents)
+	h, err := a.db.GetHouseByID(ctx, id)
+	cancel()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h == nil {
+		http.Error(w, "House not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before reading the backlog, so that nothing published in
+	// between is lost. Events seen in both are sent once.
+	sub := a.broker.Subscribe(id)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sent := newRecentIDs(sentEventsMemory)
+	sent.add(lastID)
+	send := func(e store.Event) error {
+		if !sent.add(e.ID) || !eventVisible(e, p.Role) {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Payload)
+		return err
+	}
+
+	if resume {
+		ctx, cancel := a.queryContext(r.Context(), routeHouseEvents)
+		events, err := a.db.ListLateHouseEvents(ctx, id, lastID, a.lateCommitWindow())
+		cancel()
+		if err != nil {
+			a.logger.Error("failed to read house events", zap.Int64("house_number", id), zap.Error(err))
+			return
+		}
+		for _, e := range events {
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+	for resume {
+		ctx, cancel := a.queryContext(r.Context(), routeHouseEvents)
+		events, err := a.db.ListHouseEvents(ctx, id, lastID, resumePageSize)
+		cancel()
+		if err != nil {
+			a.logger.Error("failed to read house events", zap.Int64("house_number", id), zap.Error(err))
+			return
+		}
+		for _, e := range events {
+			if err := send(e); err != nil {
+				return
+			}
+			lastID = e.ID
+		}
+		resume = len(events) == resumePageSize
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(a.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// Too slow to keep up. The client reconnects and resumes.
+				return
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// lateCommitWindow is how long before an event a write committed after it
+// may have been stamped: the longest query timeout of a route plus the clock
+// skew allowance.
+func (a *API) lateCommitWindow() time.Duration {
+	longest, unlimited := a.queryTimeout, a.queryTimeout == 0
+	for _, d := range a.routeQueryTimeouts {
+		longest = max(longest, d)
+		unlimited = unlimited || d == 0
+	}
+	if unlimited {
+		longest = max(longest, unlimitedWriteWindow)
+	}
+	return longest + maxClockSkew
+}
+
+// recentIDs remembers the last size ids added to it.
+type recentIDs struct {
+	ids   map[int64]struct{}
+	order []int64
+	next  int
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{ids: make(map[int64]struct{}, size), order: make([]int64, 0, size)}
+}
+
+// add remembers the id, forgetting the oldest one if full, and reports
+// whether it was new.
+func (s *recentIDs) add(id int64) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, id)
+	} else {
+		delete(s.ids, s.order[s.next])
+		s.order[s.next] = id
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
+
+// eventVisible applies the rules of GetFlatsByHouseID to the feed: only
+// moderators learn about flats that are not approved.
+func eventVisible(e store.Event, role string) bool {
+	switch e.Type {
+	case store.EventFlatCreated, store.EventFlatStatusChanged, store.EventFlatApproved,
+		store.EventFlatUpdated, store.EventFlatArchived, store.EventFlatPriceChanged:
+	default:
+		return false
+	}
+	if store.SeesAllFlats(role) {
+		return true
+	}
+
+	var flat store.Flat
+	if err := json.Unmarshal(e.Payload, &flat); err != nil {
+		return false
+	}
+	return flat.Status == store.StatusApproved
+}
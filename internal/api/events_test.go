@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"avtest/internal/events"
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+type sseMessage struct {
+	id, event, data, comment string
+}
+
+func TestHouseEvents(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	broker := events.NewMemoryBroker()
+	testAPI := newTestAPI(t, db)
+	testAPI.broker = broker
+	testAPI.heartbeatInterval = 20 * time.Millisecond
+	srv := httptest.NewServer(testAPI.r)
+	t.Cleanup(srv.Close)
+
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusCreated}))
+	setStatus := func(flatNumber int64, statuses ...string) {
+		t.Helper()
+		for _, status := range statuses {
+			_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{
+				HouseNumber: 1, FlatNumber: flatNumber, Status: status, Actor: "moderator", Role: store.RoleModerator,
+			})
+			require.NoError(t, err)
+		}
+	}
+	// Publishes what the outbox relay would have published.
+	var published int64
+	relay := func() {
+		t.Helper()
+		evs, err := db.ListHouseEvents(ctx, 1, published, 100)
+		require.NoError(t, err)
+		for _, e := range evs {
+			broker.Publish(e)
+			published = e.ID
+		}
+	}
+	setStatus(1, store.StatusOnModeration, store.StatusApproved)
+	relay()
+
+	rec := doRequest(t, testAPI, http.MethodGet, "/house/2/events", client.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	// The client resumes from the start and only sees the approval.
+	clientStream := openStream(t, srv.URL+"/house/1/events", client.Token, "0")
+	msg := clientStream.next(t)
+	require.Equal(t, "5", msg.id)
+	require.Equal(t, store.EventFlatApproved, msg.event)
+	require.Contains(t, msg.data, `"flat_number":1`)
+
+	moderatorStream := openStream(t, srv.URL+"/house/1/events", moderator.Token, "")
+
+	setStatus(2, store.StatusOnModeration, store.StatusApproved)
+	relay()
+
+	msg = clientStream.next(t)
+	require.Equal(t, "7", msg.id)
+	require.Equal(t, store.EventFlatApproved, msg.event)
+
+	msg = moderatorStream.next(t)
+	require.Equal(t, "6", msg.id)
+	require.Equal(t, store.EventFlatStatusChanged, msg.event)
+	msg = moderatorStream.next(t)
+	require.Equal(t, "7", msg.id)
+
+	require.Equal(t, "heartbeat", clientStream.nextComment(t))
+
+	// Events already sent are not repeated when published again.
+	broker.Publish(store.Event{ID: 7, Type: store.EventFlatApproved, HouseNumber: 1})
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 3, Status: store.StatusCreated}))
+	relay()
+	msg = moderatorStream.next(t)
+	require.Equal(t, "8", msg.id)
+	require.Equal(t, store.EventFlatCreated, msg.event)
+}
+
+func TestHouseEventsOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	broker := events.NewMemoryBroker()
+	testAPI := newTestAPI(t, db)
+	testAPI.broker = broker
+	srv := httptest.NewServer(testAPI.r)
+	t.Cleanup(srv.Close)
+
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusCreated}))
+
+	// Event 3 commits before event 2. Both reach the live stream once.
+	stream := openStream(t, srv.URL+"/house/1/events", moderator.Token, "")
+	evs, err := db.ListHouseEvents(ctx, 1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, evs, 3)
+	broker.Publish(evs[2])
+	broker.Publish(evs[1])
+	broker.Publish(evs[2])
+	broker.Publish(evs[1])
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 3, Status: store.StatusCreated}))
+	evs, err = db.ListHouseEvents(ctx, 1, 3, 10)
+	require.NoError(t, err)
+	broker.Publish(evs[0])
+	require.Equal(t, "3", stream.next(t).id)
+	require.Equal(t, "2", stream.next(t).id)
+	require.Equal(t, "4", stream.next(t).id)
+
+	// A client that got event 3 before event 2 committed gets event 2 when
+	// it resumes from 3, along with the rest of what it may have missed.
+	stream = openStream(t, srv.URL+"/house/1/events", moderator.Token, "3")
+	require.Equal(t, "2", stream.next(t).id)
+	require.Equal(t, "4", stream.next(t).id)
+}
+
+type sseStream struct {
+	r *bufio.Reader
+}
+
+func openStream(t *testing.T, url, token, lastEventID string) *sseStream {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	return &sseStream{r: bufio.NewReader(resp.Body)}
+}
+
+// read returns the next message, including comments.
+func (s *sseStream) read(t *testing.T) sseMessage {
+	t.Helper()
+
+	var msg sseMessage
+	for {
+		line, err := s.r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return msg
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			msg.comment = value
+		case "id":
+			msg.id = value
+		case "event":
+			msg.event = value
+		case "data":
+			msg.data = value
+		}
+	}
+}
+
+// next returns the next event, skipping heartbeats.
+func (s *sseStream) next(t *testing.T) sseMessage {
+	t.Helper()
+
+	for {
+		if msg := s.read(t); msg.comment == "" {
+			return msg
+		}
+	}
+}
+
+func (s *sseStream) nextComment(t *testing.T) string {
+	t.Helper()
+
+	for {
+		if msg := s.read(t); msg.comment != "" {
+			return msg.comment
+		}
+	}
+}
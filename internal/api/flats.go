@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultFlatsLimit = 50
+	maxFlatsLimit     = 500
+
+	// nextCursorHeader carries the cursor of the next page of a flat
+	// listing, which keeps its body a plain array. It is only set when there
+	// may be more flats.
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// flatCursor is the opaque cursor handed out to clients. It remembers the
+// order it was made for, so that it can't be used with another one.
+type flatCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Value  int64  `json:"v"`
+	ID     int64  `json:"id"`
+}
+
+func encodeFlatCursor(query store.FlatQuery, f store.Flat) string {
+	c := query.CursorOf(f)
+	return encodeCursor(flatCursor{SortBy: query.SortBy, Desc: query.Desc, Value: c.Value, ID: c.ID})
+}
+
+func decodeFlatCursor(query store.FlatQuery, s string) (*store.FlatCursor, error) {
+	var c flatCursor
+	if err := decodeCursor(s, &c); err != nil {
+		return nil, err
+	}
+	if c.SortBy != query.SortBy || c.Desc != query.Desc {
+		return nil, fmt.Errorf("%w: it was issued for another sort order", errInvalidCursor)
+	}
+	return &store.FlatCursor{Value: c.Value, ID: c.ID}, nil
+}
+
+// parseFlatQuery reads the listing parameters: min_price, max_price, rooms,
+// status, min_flat_number, max_flat_number, sort (price, rooms or
+// flat_number, prefixed with "-" for descending order), limit and cursor.
+func parseFlatQuery(values url.Values, role string) (store.FlatQuery, error) {
+	query := store.FlatQuery{Role: role, SortBy: store.SortByFlatNumber, Limit: defaultFlatsLimit}
+
+	var err error
+	parseInt := func(name string, dst *int) {
+		if v := values.Get(name); v != "" && err == nil {
+			n, convErr := strconv.Atoi(v)
+			if convErr != nil || n <= 0 {
+				err = fmt.Errorf("%w: %s", errInvalidFlatQuery, name)
+				return
+			}
+			*dst = n
+		}
+	}
+	var minFlatNumber, maxFlatNumber int
+	parseInt("min_price", &query.MinPrice)
+	parseInt("max_price", &query.MaxPrice)
+	parseInt("rooms", &query.Rooms)
+	parseInt("min_flat_number", &minFlatNumber)
+	parseInt("max_flat_number", &maxFlatNumber)
+	parseInt("limit", &query.Limit)
+	if err != nil {
+		return query, err
+	}
+	query.MinFlatNumber, query.MaxFlatNumber = int64(minFlatNumber), int64(maxFlatNumber)
+	if query.Limit > maxFlatsLimit {
+		return query, fmt.Errorf("%w: limit", errInvalidFlatQuery)
+	}
+
+	if v := values.Get("status"); v != "" {
+		if !store.SeesAllFlats(role) {
+			return query, errStatusFilterForbidden
+		}
+		if !store.IsValidStatus(v) {
+			return query, fmt.Errorf("%w: status", errInvalidFlatQuery)
+		}
+		query.Status = v
+	}
+
+	if v := values.Get("sort"); v != "" {
+		query.SortBy, query.Desc = strings.TrimPrefix(v, "-"), strings.HasPrefix(v, "-")
+		if !store.IsValidFlatSort(query.SortBy) {
+			return query, fmt.Errorf("%w: sort", errInvalidFlatQuery)
+		}
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		if query.After, err = decodeFlatCursor(query, v); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// flatEditRequest holds the editable details of a flat. Missing fields are
+// left as they are.
+type flatEditRequest struct {
+	Price *int `json:"price"`
+	Rooms *int `json:"rooms"`
+}
+
+// editFlatHandler changes the price and rooms of a flat. A reviewed flat
+// goes back to moderation.
+func (a *API) editFlatHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	houseNumber, flatNumber, err := flatFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req flatEditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case req.Price == nil && req.Rooms == nil:
+		http.Error(w, fmt.Sprintf("%s: nothing to change", errInvalidFlat), http.StatusBadRequest)
+		return
+	case req.Price != nil && *req.Price <= 0:
+		http.Error(w, fmt.Sprintf("%s: price", errInvalidFlat), http.StatusBadRequest)
+		return
+	case req.Rooms != nil && *req.Rooms <= 0:
+		http.Error(w, fmt.Sprintf("%s: rooms", errInvalidFlat), http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flat, err := a.db.EditFlat(r.Context(), store.FlatEdit{
+		HouseNumber: houseNumber,
+		FlatNumber:  flatNumber,
+		Price:       req.Price,
+		Rooms:       req.Rooms,
+		Actor:       p.Subject,
+		Role:        p.Role,
+		At:          time.Now(),
+
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), flatEditErrorStatus(err))
+		return
+	}
+
+	setETag(w, flat.Version)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(flat)
+}
+
+// archiveFlatHandler withdraws a flat. It stays in the database.
+func (a *API) archiveFlatHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	houseNumber, flatNumber, err := flatFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = a.db.ArchiveFlat(r.Context(), store.FlatArchival{
+		HouseNumber: houseNumber,
+		FlatNumber:  flatNumber,
+		Actor:       p.Subject,
+		Role:        p.Role,
+		At:          time.Now(),
+
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), flatEditErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "flat archived"})
+}
+
+// flatPricesHandler returns the price history of a flat. Everyone but
+// moderators only sees the history of approved flats and of their own.
+func (a *API) flatPricesHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	houseNumber, flatNumber, err := flatFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flat, err := a.db.GetFlat(r.Context(), houseNumber, flatNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if flat == nil || (!store.SeesAllFlats(p.Role) && flat.Status != store.StatusApproved && flat.Owner != p.Subject) {
+		http.Error(w, store.ErrFlatNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	prices, err := a.db.ListFlatPrices(r.Context(), flat.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if prices == nil {
+		prices = []store.FlatPrice{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]store.FlatPrice{"prices": prices})
+}
+
+// flatFromPath reads the house and flat numbers of /flat/{house}/{flat}.
+func flatFromPath(r *http.Request) (int64, int64, error) {
+	vars := mux.Vars(r)
+	houseNumber, err := strconv.ParseInt(vars["house"], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse house id: %w", err)
+	}
+	flatNumber, err := strconv.ParseInt(vars["flat"], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse flat number: %w", err)
+	}
+	return houseNumber, flatNumber, nil
+}
+
+// flatEditErrorStatus maps errors of flat edits and withdrawals to status
+// codes.
+func flatEditErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrFlatNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrNotFlatOwner), errors.Is(err, store.ErrTransitionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, store.ErrFlatOnModeration):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlatsPagination(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	for i := int64(1); i <= 5; i++ {
+		require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: i, Price: int(1000 * i), Rooms: 2, Status: store.StatusCreated}))
+	}
+	for _, status := range []string{store.StatusOnModeration, store.StatusApproved} {
+		_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 2, Status: status, Actor: "moderator", Role: store.RoleModerator})
+		require.NoError(t, err)
+	}
+
+	list := func(token string, params url.Values) (int, []store.Flat, string) {
+		t.Helper()
+		rec := doRequest(t, testAPI, http.MethodGet, "/house/1?"+params.Encode(), token, nil)
+		var flats []store.Flat
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&flats))
+		}
+		return rec.Code, flats, rec.Header().Get(nextCursorHeader)
+	}
+
+	// Walk all flats by price, highest first, two at a time.
+	params := url.Values{"sort": {"-price"}, "limit": {"2"}}
+	var got []int64
+	for {
+		code, flats, next := list(moderator.Token, params)
+		require.Equal(t, http.StatusOK, code)
+		for _, f := range flats {
+			got = append(got, f.FlatNumber)
+		}
+		if next == "" {
+			break
+		}
+		params.Set("cursor", next)
+	}
+	require.Equal(t, []int64{5, 4, 3, 2, 1}, got)
+
+	// A cursor only fits the order it was issued for.
+	params.Set("sort", "price")
+	code, _, _ := list(moderator.Token, params)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, flats, next := list(moderator.Token, url.Values{"status": {store.StatusCreated}, "min_price": {"2000"}, "max_flat_number": {"4"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, flats, 2)
+	require.Empty(t, next)
+
+	// Clients see approved flats only and can't ask for others.
+	code, flats, _ = list(client.Token, url.Values{})
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, flats, 1)
+	require.Equal(t, int64(2), flats[0].FlatNumber)
+
+	code, _, _ = list(client.Token, url.Values{"status": {store.StatusCreated}})
+	require.Equal(t, http.StatusForbidden, code)
+
+	for _, params := range []url.Values{{"sort": {"year"}}, {"limit": {"0"}}, {"rooms": {"many"}}, {"cursor": {"!"}}} {
+		code, _, _ = list(moderator.Token, params)
+		require.Equal(t, http.StatusBadRequest, code, params.Encode())
+	}
+}
+
+func TestEditAndArchiveFlat(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	owner := registerAndLogin(t, testAPI, "owner@mail.ru", Client)
+	other := registerAndLogin(t, testAPI, "other@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	rec := doRequest(t, testAPI, http.MethodPost, "/flat/create", owner.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "price": 100000, "rooms": 2,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	send := func(method, token, ifMatch string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return doRequest(t, testAPI, method, "/flat/1/1", token, body, http.Header{"If-Match": {ifMatch}})
+	}
+
+	_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusOnModeration,
+		Actor: "moderator", Role: store.RoleModerator})
+	require.NoError(t, err)
+	rec = send(http.MethodPatch, owner.Token, "", map[string]any{"price": 90000})
+	require.Equal(t, http.StatusConflict, rec.Code, rec.Body.String())
+
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusApproved,
+		Actor: "moderator", Role: store.RoleModerator})
+	require.NoError(t, err)
+	require.Len(t, getFlats(t, testAPI, other.Token, "/house/1"), 1)
+
+	rec = send(http.MethodPatch, other.Token, "", map[string]any{"price": 90000})
+	require.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = send(http.MethodPatch, owner.Token, "", map[string]any{"price": -1})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = send(http.MethodPatch, owner.Token, `"1"`, map[string]any{"price": 90000})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+	// The edited flat has to be approved again.
+	rec = send(http.MethodPatch, owner.Token, `"3"`, map[string]any{"price": 90000})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, `"4"`, rec.Header().Get("ETag"))
+	var flat store.Flat
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&flat))
+	require.Equal(t, 90000, flat.Price)
+	require.Equal(t, 2, flat.Rooms)
+	require.Equal(t, store.StatusCreated, flat.Status)
+	require.Empty(t, getFlats(t, testAPI, other.Token, "/house/1"))
+
+	// Moderators may edit any flat.
+	rec = send(http.MethodPatch, moderator.Token, "", map[string]any{"rooms": 3})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = send(http.MethodDelete, other.Token, "", nil)
+	require.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+	rec = send(http.MethodDelete, owner.Token, "", nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	require.Empty(t, getFlats(t, testAPI, moderator.Token, "/house/1"))
+	rec = send(http.MethodPatch, owner.Token, "", map[string]any{"price": 80000})
+	require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	rec = send(http.MethodDelete, owner.Token, "", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+}
+
+func TestFlatPrices(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	owner := registerAndLogin(t, testAPI, "owner@mail.ru", Client)
+	other := registerAndLogin(t, testAPI, "other@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	rec := doRequest(t, testAPI, http.MethodPost, "/flat/create", owner.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "price": 100000, "rooms": 2,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodPatch, "/flat/1/1", owner.Token, map[string]any{"price": 90000})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodPatch, "/flat/1/1", owner.Token, map[string]any{"rooms": 3})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	prices := func(token string) (int, []int) {
+		t.Helper()
+		rec := doRequest(t, testAPI, http.MethodGet, "/flat/1/1/prices", token, nil)
+		var res struct {
+			Prices []store.FlatPrice `json:"prices"`
+		}
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		var values []int
+		for _, p := range res.Prices {
+			require.False(t, p.ChangedAt.IsZero())
+			values = append(values, p.Price)
+		}
+		return rec.Code, values
+	}
+
+	code, values := prices(owner.Token)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []int{100000, 90000}, values)
+	code, _ = prices(other.Token)
+	require.Equal(t, http.StatusNotFound, code)
+	code, values = prices(moderator.Token)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []int{100000, 90000}, values)
+
+	for _, status := range []string{store.StatusOnModeration, store.StatusApproved} {
+		_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: status,
+			Actor: "moderator", Role: store.RoleModerator})
+		require.NoError(t, err)
+	}
+	code, values = prices(other.Token)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []int{100000, 90000}, values)
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/flat/1/2/prices", moderator.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+}
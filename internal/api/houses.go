@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultHousesLimit = 50
+	maxHousesLimit     = 500
+)
+
+// housesPage is a page of the house catalog. NextCursor is set when there
+// may be more houses after it.
+type housesPage struct {
+	Houses     []store.HouseSummary `json:"houses"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
+
+type houseCursor struct {
+	SortBy      string    `json:"s"`
+	Desc        bool      `json:"d,omitempty"`
+	Time        time.Time `json:"t"`
+	HouseNumber int64     `json:"n"`
+}
+
+// listHousesHandler serves the house catalog.
+func (a *API) listHousesHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseHouseQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// One house more than asked tells whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+	houses, err := a.db.ListHouses(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := housesPage{Houses: houses}
+	if len(houses) > limit {
+		page.Houses = houses[:limit]
+		c := query.CursorOf(page.Houses[limit-1].House)
+		page.NextCursor = encodeCursor(houseCursor{SortBy: query.SortBy, Desc: query.Desc, Time: c.Time, HouseNumber: c.HouseNumber})
+	}
+	if page.Houses == nil {
+		page.Houses = []store.HouseSummary{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseHouseQuery reads the catalog parameters: address, developer,
+// min_year_built, max_year_built, has_approved_flats, sort (created_at or
+// last_flat_added_at, prefixed with "-" for descending order), limit and
+// cursor.
+func parseHouseQuery(values url.Values) (store.HouseQuery, error) {
+	query := store.HouseQuery{
+		Address:   strings.TrimSpace(values.Get("address")),
+		Developer: strings.TrimSpace(values.Get("developer")),
+		SortBy:    store.SortByCreatedAt,
+		Limit:     defaultHousesLimit,
+	}
+
+	var err error
+	parseInt := func(name string, dst *int) {
+		if v := values.Get(name); v != "" && err == nil {
+			n, convErr := strconv.Atoi(v)
+			if convErr != nil || n <= 0 {
+				err = fmt.Errorf("%w: %s", errInvalidHouseQuery, name)
+				return
+			}
+			*dst = n
+		}
+	}
+	parseInt("min_year_built", &query.MinYearBuilt)
+	parseInt("max_year_built", &query.MaxYearBuilt)
+	parseInt("limit", &query.Limit)
+	if err != nil {
+		return query, err
+	}
+	if query.Limit > maxHousesLimit {
+		return query, fmt.Errorf("%w: limit", errInvalidHouseQuery)
+	}
+
+	if v := values.Get("has_approved_flats"); v != "" {
+		if query.HasApprovedFlats, err = strconv.ParseBool(v); err != nil {
+			return query, fmt.Errorf("%w: has_approved_flats", errInvalidHouseQuery)
+		}
+	}
+
+	if v := values.Get("sort"); v != "" {
+		query.SortBy, query.Desc = strings.TrimPrefix(v, "-"), strings.HasPrefix(v, "-")
+		if !store.IsValidHouseSort(query.SortBy) {
+			return query, fmt.Errorf("%w: sort", errInvalidHouseQuery)
+		}
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		var c houseCursor
+		if err := decodeCursor(v, &c); err != nil {
+			return query, err
+		}
+		if c.SortBy != query.SortBy || c.Desc != query.Desc {
+			return query, fmt.Errorf("%w: it was issued for another sort order", errInvalidCursor)
+		}
+		query.After = &store.HouseCursor{Time: c.Time, HouseNumber: c.HouseNumber}
+	}
+	return query, nil
+}
+
+// houseUpdateRequest holds the editable details of a house. PATCH leaves
+// missing fields as they are, PUT replaces all of them.
+type houseUpdateRequest struct {
+	Address   *string `json:"address"`
+	Developer *string `json:"developer"`
+	YearBuilt *int    `json:"year_built"`
+}
+
+// updateHouseHandler edits the address, developer and year built of a house.
+func (a *API) updateHouseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse house id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var req houseUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(r.Method == http.MethodPut); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	house, err := a.db.UpdateHouse(r.Context(), store.HouseUpdate{
+		HouseNumber: id,
+		Address:     req.Address,
+		Developer:   req.Developer,
+		YearBuilt:   req.YearBuilt,
+		At:          time.Now(),
+
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), houseWriteErrorStatus(err))
+		return
+	}
+
+	setETag(w, house.Version)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(house)
+}
+
+// validate checks the given fields. A full update must set the address and
+// the year, and clears the developer when it is missing.
+func (req *houseUpdateRequest) validate(full bool) error {
+	if full {
+		if req.Address == nil || req.YearBuilt == nil {
+			return fmt.Errorf("%w: address and year_built are required", errInvalidHouse)
+		}
+		if req.Developer == nil {
+			req.Developer = new(string)
+		}
+	}
+	if req.Address != nil && strings.TrimSpace(*req.Address) == "" {
+		return fmt.Errorf("%w: address", errInvalidHouse)
+	}
+	if req.YearBuilt != nil && *req.YearBuilt <= 0 {
+		return fmt.Errorf("%w: year_built", errInvalidHouse)
+	}
+	return nil
+}
+
+// deleteHouseHandler hides the house and its flats. They stay in the
+// database.
+func (a *API) deleteHouseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse house id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = a.db.DeleteHouse(r.Context(), id, expectedVersion, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), houseWriteErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "house deleted"})
+}
+
+// houseWriteErrorStatus maps errors of house updates and deletes to status
+// codes.
+func houseWriteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrHouseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListHouses(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+
+	created := time.Now().Add(-time.Hour)
+	houses := []store.House{
+		{HouseNumber: 1, Address: "Lenina 1", YearBuilt: 1990, Developer: "PIK"},
+		{HouseNumber: 2, Address: "Lenina 2", YearBuilt: 2010, Developer: "Samolet"},
+		{HouseNumber: 3, Address: "Mira 3", YearBuilt: 2020, Developer: "pik"},
+	}
+	for i, h := range houses {
+		h.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, db.CreateHouse(ctx, &h))
+	}
+	// House 3 has a flat under review and an approved one.
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 3, FlatNumber: 1, Status: store.StatusCreated, CreatedAt: time.Now()}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 3, FlatNumber: 2, Status: store.StatusCreated, CreatedAt: time.Now()}))
+	for _, change := range []store.FlatStatusChange{
+		{FlatNumber: 1, Status: store.StatusOnModeration},
+		{FlatNumber: 2, Status: store.StatusOnModeration},
+		{FlatNumber: 2, Status: store.StatusApproved},
+	} {
+		change.HouseNumber, change.Actor, change.Role = 3, "moderator", store.RoleModerator
+		_, err := db.ChangeFlatStatus(ctx, change)
+		require.NoError(t, err)
+	}
+
+	list := func(params url.Values) (int, housesPage) {
+		t.Helper()
+		rec := doRequest(t, testAPI, http.MethodGet, "/houses?"+params.Encode(), client.Token, nil)
+		var page housesPage
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		}
+		return rec.Code, page
+	}
+	numbers := func(page housesPage) []int64 {
+		var res []int64
+		for _, h := range page.Houses {
+			res = append(res, h.HouseNumber)
+		}
+		return res
+	}
+
+	code, page := list(url.Values{"sort": {"-created_at"}, "limit": {"2"}})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []int64{3, 2}, numbers(page))
+	require.NotEmpty(t, page.NextCursor)
+	require.EqualValues(t, 1, page.Houses[0].ApprovedFlats)
+
+	code, page = list(url.Values{"sort": {"-created_at"}, "limit": {"2"}, "cursor": {page.NextCursor}})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []int64{1}, numbers(page))
+	require.Empty(t, page.NextCursor)
+
+	tests := []struct {
+		params url.Values
+		want   []int64
+	}{
+		{params: url.Values{"address": {"lenina"}}, want: []int64{1, 2}},
+		{params: url.Values{"developer": {"PIK"}}, want: []int64{1, 3}},
+		{params: url.Values{"min_year_built": {"2000"}, "max_year_built": {"2015"}}, want: []int64{2}},
+		{params: url.Values{"has_approved_flats": {"true"}}, want: []int64{3}},
+		{params: url.Values{"sort": {"-last_flat_added_at"}}, want: []int64{3, 2, 1}},
+	}
+	for _, tt := range tests {
+		code, page := list(tt.params)
+		require.Equal(t, http.StatusOK, code, tt.params.Encode())
+		require.Equal(t, tt.want, numbers(page), tt.params.Encode())
+	}
+
+	for _, params := range []url.Values{{"sort": {"address"}}, {"has_approved_flats": {"maybe"}}, {"min_year_built": {"-1"}}, {"cursor": {"x"}}} {
+		code, _ := list(params)
+		require.Equal(t, http.StatusBadRequest, code, params.Encode())
+	}
+
+	rec := doRequest(t, testAPI, http.MethodGet, "/houses", "", nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestUpdateAndDeleteHouse(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "Lenina 1", YearBuilt: 1990, Developer: "PIK"}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated, CreatedAt: time.Now()}))
+
+	send := func(method, token, ifMatch string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		return doRequest(t, testAPI, method, "/house/1", token, body, http.Header{"If-Match": {ifMatch}})
+	}
+
+	rec := send(http.MethodPatch, client.Token, "", map[string]any{"address": "Lenina 2"})
+	require.Equal(t, http.StatusForbidden, rec.Code, rec.Body.String())
+
+	rec = send(http.MethodPut, moderator.Token, "", map[string]any{"address": "Lenina 2"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	// The flat bumped the house to version 2.
+	rec = send(http.MethodPatch, moderator.Token, `"2"`, map[string]any{"address": "Lenina 2"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	var house store.House
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&house))
+	require.Equal(t, "Lenina 2", house.Address)
+	require.Equal(t, "PIK", house.Developer)
+	require.Equal(t, 1990, house.YearBuilt)
+
+	rec = send(http.MethodPut, moderator.Token, `"2"`, map[string]any{"address": "Lenina 3", "year_built": 1991})
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+	// PUT clears the developer it wasn't given.
+	rec = send(http.MethodPut, moderator.Token, `"3"`, map[string]any{"address": "Lenina 3", "year_built": 1991})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	house = store.House{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&house))
+	require.Equal(t, store.House{HouseNumber: 1, Address: "Lenina 3", YearBuilt: 1991, CreatedAt: house.CreatedAt,
+		LastFlatAddedAt: house.LastFlatAddedAt, Version: 4}, house)
+
+	rec = send(http.MethodDelete, moderator.Token, `"3"`, nil)
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+	rec = send(http.MethodDelete, moderator.Token, `"4"`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// The house and its flats are gone from every view.
+	rec = doRequest(t, testAPI, http.MethodGet, "/house/1", client.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodGet, "/houses", client.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var page housesPage
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	require.Empty(t, page.Houses)
+	queue, err := db.ListModerationQueue(ctx, store.ModerationQueueFilter{})
+	require.NoError(t, err)
+	require.Empty(t, queue)
+
+	rec = send(http.MethodDelete, moderator.Token, "", nil)
+	require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	rec = send(http.MethodPatch, moderator.Token, "", map[string]any{"address": "Lenina 4"})
+	require.Equal(t, http.StatusNotFound, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/create", moderator.Token, map[string]any{
+		"house_number": 1, "flat_number": 2, "price": 100000, "rooms": 2,
+	})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+}
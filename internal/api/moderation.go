@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// leaseHeartbeatHandler extends the moderation lease held by the caller.
+func (a *API) leaseHeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req *store.Flat
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(a.moderationLease)
+	err = a.db.ExtendFlatLease(r.Context(), req.HouseNumber, req.FlatNumber, p.Subject, expiresAt)
+	if errors.Is(err, store.ErrLeaseNotHeld) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.writeFlat(r.Context(), w, req.HouseNumber, req.FlatNumber)
+}
+
+// releaseLeaseHandler lets admins return a flat under review to the queue
+// regardless of who holds it.
+func (a *API) releaseLeaseHandler(w http.ResponseWriter, r *http.Request) {
+	var req *store.Flat
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := a.db.ReleaseFlatLease(r.Context(), req.HouseNumber, req.FlatNumber)
+	if errors.Is(err, store.ErrFlatNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), transitionErrorStatus(err))
+		return
+	}
+
+	a.writeFlat(r.Context(), w, req.HouseNumber, req.FlatNumber)
+}
+
+const (
+	defaultQueueLimit = 50
+	maxQueueLimit     = 100
+)
+
+// nextFlatHandler takes the oldest flat waiting for review on moderation
+// for the caller. It answers 204 when the queue is empty.
+func (a *API) nextFlatHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	filter, err := parseQueueFilter(r.URL.Query(), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flat, err := a.db.ClaimNextFlat(r.Context(), filter, p.Subject, now, now.Add(a.moderationLease))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if flat == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	setETag(w, flat.Version)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(flat)
+}
+
+func (a *API) moderationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseQueueFilter(query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Limit = defaultQueueLimit
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxQueueLimit {
+			http.Error(w, fmt.Sprintf("%v: limit", errInvalidQueueFilter), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	flats, err := a.db.ListModerationQueue(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if flats == nil {
+		flats = []store.Flat{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(flats)
+}
+
+// parseQueueFilter reads the house_id, min_age and max_age query parameters.
+// Ages are durations like 30m or 2h counted back from now.
+func parseQueueFilter(query url.Values, now time.Time) (store.ModerationQueueFilter, error) {
+	var filter store.ModerationQueueFilter
+
+	if v := query.Get("house_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("%w: house_id", errInvalidQueueFilter)
+		}
+		filter.HouseNumber = id
+	}
+	if v := query.Get("min_age"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age < 0 {
+			return filter, fmt.Errorf("%w: min_age", errInvalidQueueFilter)
+		}
+		filter.CreatedBefore = now.Add(-age)
+	}
+	if v := query.Get("max_age"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age < 0 {
+			return filter, fmt.Errorf("%w: max_age", errInvalidQueueFilter)
+		}
+		filter.CreatedAfter = now.Add(-age)
+	}
+	return filter, nil
+}
+
+func (a *API) writeFlat(ctx context.Context, w http.ResponseWriter, houseNumber, flatNumber int64) {
+	flat, err := a.db.GetFlat(ctx, houseNumber, flatNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if flat != nil {
+		setETag(w, flat.Version)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(flat)
+}
+
+// maxDecisionComment is the longest comment a moderator may leave, in
+// characters.
+const maxDecisionComment = 1000
+
+// flatStatusRequest is a status change of a flat. Declines name a reason
+// from the catalogue and may have a comment for the owner.
+type flatStatusRequest struct {
+	store.Flat
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+// validateDecision checks the reason and the comment of a status change.
+func (a *API) validateDecision(req *flatStatusRequest) error {
+	if req.Status == store.StatusDeclined {
+		if _, ok := a.declineReasons[req.Reason]; !ok {
+			return fmt.Errorf("%w: reason must be one of %s", errInvalidDecision, strings.Join(a.declineReasonCodes(), ", "))
+		}
+	} else if req.Reason != "" {
+		return fmt.Errorf("%w: only declines have a reason", errInvalidDecision)
+	}
+
+	if req.Comment != "" && !store.IsDecision(req.Status) {
+		return fmt.Errorf("%w: only approvals and declines have a comment", errInvalidDecision)
+	}
+	if len([]rune(req.Comment)) > maxDecisionComment {
+		return fmt.Errorf("%w: comment is longer than %d characters", errInvalidDecision, maxDecisionComment)
+	}
+	return nil
+}
+
+func (a *API) declineReasonCodes() []string {
+	codes := make([]string, 0, len(a.declineReasons))
+	for code := range a.declineReasons {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// moderationEntry is a decision with the title of its reason in the current
+// catalogue.
+type moderationEntry struct {
+	store.ModerationDecision
+	ReasonTitle string `json:"reason_title,omitempty"`
+}
+
+// flatModerationHandler returns the moderation history of a flat to its
+// owner and to moderators.
+func (a *API) flatModerationHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	houseNumber, flatNumber, err := flatFromPath(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flat, err := a.db.GetFlat(r.Context(), houseNumber, flatNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if flat == nil || (!store.SeesAllFlats(p.Role) && flat.Owner != p.Subject) {
+		http.Error(w, store.ErrFlatNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	decisions, err := a.db.ListModerationDecisions(r.Context(), flat.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries := []moderationEntry{}
+	for _, d := range decisions {
+		entries = append(entries, moderationEntry{ModerationDecision: d, ReasonTitle: a.declineReasons[d.Reason]})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]moderationEntry{"moderation": entries})
+}
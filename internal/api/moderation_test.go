@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerationLease(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	first := registerAndLogin(t, testAPI, "first@mail.ru", Moderator)
+	second := registerAndLogin(t, testAPI, "second@mail.ru", Moderator)
+	admin := registerAndLogin(t, testAPI, "admin@mail.ru", Admin)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Price: 100000, Rooms: 2, Status: store.StatusCreated}))
+	ref := map[string]any{"house_number": 1, "flat_number": 1}
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/flat/update", first.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "status": store.StatusOnModeration,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var taken store.Flat
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&taken))
+	require.NotNil(t, taken.ModerationStartedAt)
+	require.NotNil(t, taken.LeaseExpiresAt)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/heartbeat", first.Token, ref)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var extended store.Flat
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&extended))
+	require.False(t, extended.LeaseExpiresAt.Before(*taken.LeaseExpiresAt))
+
+	// Only the holder can keep the lease alive.
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/heartbeat", second.Token, ref)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	// Only admins can force a lease to end.
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/release", second.Token, ref)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/release", admin.Token, ref)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	flat, err := db.GetFlatStatus(ctx, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, store.StatusCreated, flat.Status)
+
+	// A released flat has no lease to release.
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/release", admin.Token, ref)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/heartbeat", first.Token, ref)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", second.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "status": store.StatusOnModeration,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	n, err := db.ReleaseExpiredLeases(ctx, time.Now().Add(2*testAPI.moderationLease))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/lease/release", admin.Token, map[string]any{"house_number": 1, "flat_number": 2})
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestFlatUpdateIfMatch(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	rec := doRequest(t, testAPI, http.MethodPost, "/flat/create", moderator.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "price": 100000, "rooms": 2,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	require.Equal(t, `"1"`, etag)
+
+	update := func(status, ifMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		return doRequest(t, testAPI, http.MethodPost, "/flat/update", moderator.Token,
+			map[string]any{"house_number": 1, "flat_number": 1, "status": status}, http.Header{"If-Match": {ifMatch}})
+	}
+
+	rec = update(store.StatusOnModeration, etag)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// The flat has moved on since the first ETag was issued.
+	rec = update(store.StatusApproved, etag)
+	require.Equal(t, http.StatusPreconditionFailed, rec.Code, rec.Body.String())
+
+	rec = update(store.StatusApproved, "not-a-tag")
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	rec = update(store.StatusApproved, `"2"`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Equal(t, `"3"`, rec.Header().Get("ETag"))
+}
+
+func TestConcurrentFlatUpdate(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	moderators := []tokenPair{
+		registerAndLogin(t, testAPI, "first@mail.ru", Moderator),
+		registerAndLogin(t, testAPI, "second@mail.ru", Moderator),
+		registerAndLogin(t, testAPI, "third@mail.ru", Moderator),
+	}
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Price: 100000, Rooms: 2, Status: store.StatusCreated}))
+
+	// Every moderator tries to take the flat and approve it at once: the
+	// flat goes on moderation exactly once and only its holder approves it.
+	codes := make(chan int, 2*len(moderators))
+	var wg sync.WaitGroup
+	for _, m := range moderators {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			for _, status := range []string{store.StatusOnModeration, store.StatusApproved} {
+				rec := doRequest(t, testAPI, http.MethodPost, "/flat/update", token, map[string]any{
+					"house_number": 1, "flat_number": 1, "status": status,
+				})
+				codes <- rec.Code
+			}
+		}(m.Token)
+	}
+	wg.Wait()
+	close(codes)
+
+	var succeeded int
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	require.Equal(t, 2, succeeded)
+
+	flat, err := db.GetFlatStatus(ctx, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, store.StatusApproved, flat.Status)
+}
+
+func TestModerationQueue(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+
+	now := time.Now()
+	for _, house := range []int64{1, 2} {
+		require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: house, Address: "test address", YearBuilt: 2021}))
+	}
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated, CreatedAt: now.Add(-time.Minute)}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 2, FlatNumber: 1, Status: store.StatusCreated, CreatedAt: now.Add(-2 * time.Hour)}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusCreated, CreatedAt: now.Add(-time.Hour)}))
+
+	rec := doRequest(t, testAPI, http.MethodGet, "/moderation/queue", client.Token, nil)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	tests := []struct {
+		name   string
+		target string
+		want   []int64
+	}{
+		{name: "all", target: "/moderation/queue", want: []int64{2, 1, 1}},
+		{name: "house", target: "/moderation/queue?house_id=1", want: []int64{1, 1}},
+		{name: "min age", target: "/moderation/queue?min_age=30m", want: []int64{2, 1}},
+		{name: "max age", target: "/moderation/queue?max_age=90m", want: []int64{1, 1}},
+		{name: "limit", target: "/moderation/queue?limit=1", want: []int64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, testAPI, http.MethodGet, tt.target, moderator.Token, nil)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			var flats []store.Flat
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&flats))
+
+			var houses []int64
+			for _, f := range flats {
+				houses = append(houses, f.HouseNumber)
+			}
+			require.Equal(t, tt.want, houses)
+		})
+	}
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/moderation/queue?min_age=soon", moderator.Token, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/moderation/next?house_id=1", moderator.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var claimed store.Flat
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&claimed))
+	require.Equal(t, int64(1), claimed.HouseNumber)
+	require.Equal(t, int64(2), claimed.FlatNumber)
+	require.Equal(t, store.StatusOnModeration, claimed.Status)
+	require.NotNil(t, claimed.LeaseExpiresAt)
+
+	// The claimed flat can be decided by the moderator who got it.
+	rec = doRequest(t, testAPI, http.MethodPost, "/flat/update", moderator.Token, map[string]any{
+		"house_number": 1, "flat_number": 2, "status": store.StatusApproved,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	for i := 0; i < 2; i++ {
+		rec = doRequest(t, testAPI, http.MethodGet, "/moderation/next", moderator.Token, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, testAPI, http.MethodGet, "/moderation/next", moderator.Token, nil)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestDeclineReasons(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	owner := registerAndLogin(t, testAPI, "owner@mail.ru", Client)
+	other := registerAndLogin(t, testAPI, "other@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	rec := doRequest(t, testAPI, http.MethodPost, "/flat/create", owner.Token, map[string]any{
+		"house_number": 1, "flat_number": 1, "price": 100000, "rooms": 2,
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	setStatus := func(status string, extra map[string]any) *httptest.ResponseRecorder {
+		t.Helper()
+		body := map[string]any{"house_number": 1, "flat_number": 1, "status": status}
+		for k, v := range extra {
+			body[k] = v
+		}
+		return doRequest(t, testAPI, http.MethodPost, "/flat/update", moderator.Token, body)
+	}
+
+	rec = setStatus(store.StatusOnModeration, map[string]any{"reason": "wrong_price"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = setStatus(store.StatusOnModeration, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// A decline needs a reason from the catalogue.
+	rec = setStatus(store.StatusDeclined, map[string]any{"comment": "the price is off"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), "duplicate, wrong_price")
+	rec = setStatus(store.StatusDeclined, map[string]any{"reason": "too_cheap"})
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	rec = setStatus(store.StatusDeclined, map[string]any{"reason": "wrong_price", "comment": "the price is off"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	history := func(token string) (int, []moderationEntry) {
+		t.Helper()
+		rec := doRequest(t, testAPI, http.MethodGet, "/flat/1/1/moderation", token, nil)
+		var res map[string][]moderationEntry
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+		}
+		return rec.Code, res["moderation"]
+	}
+
+	code, _ := history(other.Token)
+	require.Equal(t, http.StatusNotFound, code)
+	code, entries := history(owner.Token)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, entries, 1)
+	require.Equal(t, store.StatusDeclined, entries[0].Status)
+	require.Equal(t, "wrong_price", entries[0].Reason)
+	require.Equal(t, "Wrong price", entries[0].ReasonTitle)
+	require.Equal(t, "the price is off", entries[0].Comment)
+
+	// The owner fixes the price and the flat is reviewed again.
+	rec = doRequest(t, testAPI, http.MethodPatch, "/flat/1/1", owner.Token, map[string]any{"price": 90000})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = setStatus(store.StatusOnModeration, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = setStatus(store.StatusApproved, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	code, entries = history(moderator.Token)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, entries, 2)
+	require.Equal(t, store.StatusApproved, entries[1].Status)
+	require.Empty(t, entries[1].Reason)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+
+	"avtest/internal/store"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request ids taken from clients to something
+// safe to log and to store.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID identifies every request, taking the id from the client or a
+// proxy in front of the service when there is a sane one. The id is sent
+// back and recorded with the writes the request makes.
+func (a *API) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			var err error
+			if id, err = randomString(16); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := store.WithAudit(r.Context(), store.AuditInfo{RequestID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
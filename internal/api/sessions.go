@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+
+	"go.uber.org/zap"
+)
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issueTokens starts a new session for the user.
+func (a *API) issueTokens(ctx context.Context, u *store.User) (*tokenPair, error) {
+	familyID, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := a.newRefreshToken(strconv.FormatInt(u.ID, 10), familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.db.CreateRefreshToken(ctx, record); err != nil {
+		return nil, err
+	}
+
+	token, err := a.generateToken(record.Subject, u.Email, u.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{Token: token, RefreshToken: refreshToken}, nil
+}
+
+// newRefreshToken generates an opaque refresh token and the record to store
+// for it.
+func (a *API) newRefreshToken(subject, familyID string) (string, *store.RefreshToken, error) {
+	refreshToken, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	return refreshToken, &store.RefreshToken{
+		TokenHash: hashRefreshToken(refreshToken),
+		FamilyID:  familyID,
+		Subject:   subject,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.refreshTokenTTL),
+	}, nil
+}
+
+func (a *API) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	oldHash := hashRefreshToken(req.RefreshToken)
+	old, err := a.db.GetRefreshToken(r.Context(), oldHash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if old == nil || old.ExpiresAt.Before(time.Now()) {
+		http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	if old.UsedAt != nil || old.RevokedAt != nil {
+		a.revokeReusedFamily(r.Context(), old)
+		http.Error(w, store.ErrRefreshTokenReused.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.ParseInt(old.Subject, 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	u, err := a.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if u == nil {
+		http.Error(w, errInvalidRefreshToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	if u.DisabledAt != nil {
+		http.Error(w, errAccountDisabled.Error(), http.StatusForbidden)
+		return
+	}
+
+	refreshToken, next, err := a.newRefreshToken(old.Subject, old.FamilyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = a.db.RotateRefreshToken(asUser(r.Context(), u), oldHash, next)
+	if errors.Is(err, store.ErrRefreshTokenReused) {
+		// Another request rotated the same token first.
+		a.revokeReusedFamily(r.Context(), old)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := a.generateToken(old.Subject, u.Email, u.Type)
+	if err != nil {
+		http.Error(w, errFailedToGenerateJWT.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokenPair{Token: token, RefreshToken: refreshToken})
+}
+
+// revokeReusedFamily ends the session a replayed refresh token belongs to.
+// Either the legitimate client or an attacker holds a stolen token, and we
+// can't tell which, so both have to log in again.
+func (a *API) revokeReusedFamily(ctx context.Context, t *store.RefreshToken) {
+	a.logger.Warn("refresh token reuse detected",
+		zap.String("subject", t.Subject), zap.String("family_id", t.FamilyID))
+
+	if err := a.db.RevokeRefreshTokenFamily(ctx, *t); err != nil {
+		a.logger.Error("failed to revoke refresh token family", zap.Error(err))
+	}
+}
+
+func (a *API) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// The refresh token is optional: without it only the access token is
+	// revoked and the refresh token simply expires.
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logout := store.Logout{Subject: p.Subject, TokenID: p.TokenID, ExpiresAt: p.ExpiresAt, At: time.Now()}
+	if req.RefreshToken != "" {
+		t, err := a.db.GetRefreshToken(r.Context(), hashRefreshToken(req.RefreshToken))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if t != nil && t.Subject == p.Subject {
+			logout.FamilyID = t.FamilyID
+		}
+	}
+
+	if err := a.db.Logout(r.Context(), logout); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "logged out"})
+}
+
+func (a *API) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.db.LogoutAll(r.Context(), p.Subject, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "logged out of all sessions"})
+}
+
+// hashRefreshToken returns the value stored instead of the refresh token.
+// Refresh tokens are random, so a plain SHA-256 is enough.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
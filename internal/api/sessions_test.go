@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+	first := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: first.RefreshToken})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var second tokenPair
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&second))
+	require.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/house/1", second.Token, nil)
+	require.NotEqual(t, http.StatusUnauthorized, rec.Code)
+
+	// Replaying the rotated token revokes the whole session.
+	rec = doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: first.RefreshToken})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: second.RefreshToken})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: "unknown"})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestLogout(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+	session := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/logout", session.Token, refreshTokenRequest{RefreshToken: session.RefreshToken})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/house/1", session.Token, nil)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: session.RefreshToken})
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+	first := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+	second := login(t, testAPI, "client@mail.ru")
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/logout/all", first.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	for _, session := range []tokenPair{first, second} {
+		rec = doRequest(t, testAPI, http.MethodGet, "/house/1", session.Token, nil)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = doRequest(t, testAPI, http.MethodPost, "/token/refresh", "", refreshTokenRequest{RefreshToken: session.RefreshToken})
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	// A login within the same second is a new session and is not revoked.
+	third := login(t, testAPI, "client@mail.ru")
+	rec = doRequest(t, testAPI, http.MethodGet, "/houses", third.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+// registerAndLogin signs up a user, by invitation unless they are a client.
+func registerAndLogin(t *testing.T, a *API, email, role string) tokenPair {
+	t.Helper()
+
+	req := map[string]string{
+		"email":    email,
+		"password": "testpass",
+		"type":     role,
+	}
+	if role != Client {
+		req["invitation"] = invite(t, a, email, role)
+	}
+	rec := doRequest(t, a, http.MethodPost, "/register", "", req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	return login(t, a, email)
+}
+
+// invite creates an invitation straight in the store and returns its token.
+func invite(t *testing.T, a *API, email, role string) string {
+	t.Helper()
+
+	token, inv, err := a.newInvitation(email, role, "")
+	require.NoError(t, err)
+	require.NoError(t, a.db.CreateInvitation(context.Background(), inv))
+	return token
+}
+
+func login(t *testing.T, a *API, email string) tokenPair {
+	t.Helper()
+
+	rec := doRequest(t, a, http.MethodPost, "/login", "", map[string]string{
+		"email":    email,
+		"password": "testpass",
+	})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var tokens tokenPair
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&tokens))
+	return tokens
+}
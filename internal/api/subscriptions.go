@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+type subscriptionRequest struct {
+	Email string `json:"email"`
+}
+
+func (a *API) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	houseNumber, email, ok := a.subscriptionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	sub := &store.Subscription{
+		Email:       email,
+		HouseNumber: houseNumber,
+		CreatedAt:   time.Now(),
+	}
+	err := a.db.CreateSubscription(r.Context(), sub)
+	if errors.Is(err, store.ErrHouseNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Subscribed successfully"})
+}
+
+func (a *API) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	houseNumber, email, ok := a.subscriptionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.db.DeleteSubscription(r.Context(), email, houseNumber)
+	if errors.Is(err, store.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unsubscribed successfully"})
+}
+
+// subscriptionTarget reads the house from the route and the email of the
+// subscriber. Registered users are subscribed with the email from their
+// token; tokens from /dummyLogin carry none, so it has to be in the body.
+func (a *API) subscriptionTarget(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return 0, "", false
+	}
+
+	houseNumber, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse house id: %s", err), http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	email := p.Email
+	if email == "" {
+		var req subscriptionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return 0, "", false
+		}
+		email = req.Email
+	}
+	if email == "" {
+		http.Error(w, errEmailRequired.Error(), http.StatusBadRequest)
+		return 0, "", false
+	}
+	return houseNumber, email, true
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"avtest/internal/notify"
+	"avtest/internal/outbox"
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type chanSender chan notify.Message
+
+func (s chanSender) Send(_ context.Context, msg notify.Message) error {
+	s <- msg
+	return nil
+}
+
+func TestSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	sent := make(chanSender, 10)
+	inProcess := outbox.NewInProcessPublisher()
+	inProcess.Subscribe("notify", notify.NewNotifier(zap.NewNop(), db, sent, 10).HandleEvent)
+	relay := outbox.NewRelay(zap.NewNop(), db, inProcess, newTestConfig())
+
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Price: 100000, Rooms: 2, Status: store.StatusCreated}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Price: 100000, Rooms: 2, Status: store.StatusCreated}))
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/house/2/subscribe", client.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/house/1/subscribe", client.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodPost, "/house/1/subscribe", client.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	approve := func(flatNumber int64) {
+		t.Helper()
+		for _, status := range []string{store.StatusOnModeration, store.StatusApproved} {
+			rec := doRequest(t, testAPI, http.MethodPost, "/flat/update", moderator.Token, map[string]any{
+				"house_number": 1, "flat_number": flatNumber, "status": status,
+			})
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		}
+	}
+
+	approve(1)
+	relay.RelayOnce(context.Background())
+	require.Len(t, sent, 1)
+	require.Equal(t, "client@mail.ru", (<-sent).To)
+
+	rec = doRequest(t, testAPI, http.MethodDelete, "/house/1/subscribe", client.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodDelete, "/house/1/subscribe", client.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	approve(2)
+	relay.RelayOnce(context.Background())
+	require.Empty(t, sent)
+}
+
+func TestSubscribeDummyLogin(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "test address", YearBuilt: 2021}))
+
+	token, err := testAPI.generateToken("", "", Client)
+	require.NoError(t, err)
+
+	rec := doRequest(t, testAPI, http.MethodPost, "/house/1/subscribe", token, nil)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/house/1/subscribe", token, subscriptionRequest{Email: "dummy@mail.ru"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	emails, err := db.GetHouseSubscribers(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dummy@mail.ru"}, emails)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// routeHouseEvents names the SSE route. A stream stays open for as long as
+// the client listens, so its queries are limited one by one instead.
+const routeHouseEvents = "house.events"
+
+// limitQueries puts the route's deadline on the request context, so queries of a slow
+// or abandoned request don't hold a database connection indefinitely.
+func (a *API) limitQueries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := routeName(r)
+		if name == routeHouseEvents {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := a.queryContext(r.Context(), name)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// queryContext applies the query timeout of the route to ctx. A zero
+// timeout means no limit.
+func (a *API) queryContext(ctx context.Context, route string) (context.Context, context.CancelFunc) {
+	if d := a.routeQueryTimeout(route); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+func (a *API) routeQueryTimeout(route string) time.Duration {
+	if d, ok := a.routeQueryTimeouts[route]; ok {
+		return d
+	}
+	return a.queryTimeout
+}
+
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		return route.GetName()
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"avtest/internal/store/memory"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitQueries(t *testing.T) {
+	testAPI := newTestAPI(t, memory.NewMemoryDB())
+	testAPI.queryTimeout = time.Minute
+	testAPI.routeQueryTimeouts = map[string]time.Duration{"house.flats": time.Hour, "moderation.queue": 0}
+
+	type deadline struct {
+		set  bool
+		left time.Duration
+	}
+	var got deadline
+	probe := func(w http.ResponseWriter, r *http.Request) {
+		d, ok := r.Context().Deadline()
+		got = deadline{set: ok, left: time.Until(d)}
+	}
+
+	r := mux.NewRouter()
+	r.Use(testAPI.limitQueries)
+	for _, name := range []string{"login", "house.flats", "moderation.queue", routeHouseEvents} {
+		r.HandleFunc("/"+name, probe).Name(name)
+	}
+
+	tests := []struct {
+		route string
+		want  time.Duration
+	}{
+		{route: "login", want: time.Minute},
+		{route: "house.flats", want: time.Hour},
+		{route: "moderation.queue"},
+		{route: routeHouseEvents},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			got = deadline{}
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/"+tt.route, nil))
+
+			require.Equal(t, tt.want != 0, got.set)
+			if tt.want != 0 {
+				require.InDelta(t, tt.want, got.left, float64(time.Second))
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 100
+)
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	EventTypes []string `json:"event_types"`
+}
+
+// createWebhookHandler registers a webhook. The secret is generated unless
+// given, and this is the only response that contains it.
+func (a *API) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := principalFrom(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req createWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, errInvalidWebhookURL.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.EventTypes) == 0 {
+		http.Error(w, errInvalidEventType.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(store.EventTypes, eventType) {
+			http.Error(w, fmt.Sprintf("%v: %s", errInvalidEventType, eventType), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Secret == "" {
+		req.Secret, err = randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	webhook := &store.Webhook{
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: req.EventTypes,
+		CreatedBy:  p.Subject,
+		CreatedAt:  time.Now(),
+	}
+	if err := a.db.CreateWebhook(r.Context(), webhook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (a *API) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := a.db.ListWebhooks(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := []store.Webhook{}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+		res = append(res, webhook)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (a *API) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse webhook id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err = a.db.DeleteWebhook(r.Context(), id)
+	if errors.Is(err, store.ErrWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "webhook deleted"})
+}
+
+// listWebhookDeliveriesHandler returns the latest deliveries of a webhook,
+// newest first.
+func (a *API) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse webhook id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxDeliveriesLimit {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	webhook, err := a.db.GetWebhook(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if webhook == nil {
+		http.Error(w, store.ErrWebhookNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := a.db.ListWebhookDeliveries(r.Context(), id, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []store.WebhookDelivery{}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// replayWebhookDeliveryHandler sends a delivery again, whatever happened to
+// it before.
+func (a *API) replayWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse webhook id: %s", err), http.StatusBadRequest)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(vars["delivery_id"], 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to parse delivery id: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	err = a.db.ReplayWebhookDelivery(r.Context(), id, deliveryID, time.Now())
+	if errors.Is(err, store.ErrWebhookDeliveryNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "delivery queued"})
+}
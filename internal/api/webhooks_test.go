@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	testAPI := newTestAPI(t, db)
+	moderator := registerAndLogin(t, testAPI, "moderator@mail.ru", Moderator)
+	client := registerAndLogin(t, testAPI, "client@mail.ru", Client)
+
+	valid := createWebhookRequest{URL: "https://partner.example/hook", EventTypes: []string{store.EventFlatApproved}}
+	rec := doRequest(t, testAPI, http.MethodPost, "/webhooks", client.Token, valid)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	tests := []struct {
+		name string
+		req  createWebhookRequest
+	}{
+		{name: "relative url", req: createWebhookRequest{URL: "/hook", EventTypes: []string{store.EventFlatApproved}}},
+		{name: "ftp url", req: createWebhookRequest{URL: "ftp://partner.example", EventTypes: []string{store.EventFlatApproved}}},
+		{name: "no events", req: createWebhookRequest{URL: "https://partner.example/hook"}},
+		{name: "unknown event", req: createWebhookRequest{URL: "https://partner.example/hook", EventTypes: []string{"flat.sold"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, testAPI, http.MethodPost, "/webhooks", moderator.Token, tt.req)
+			require.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	rec = doRequest(t, testAPI, http.MethodPost, "/webhooks", moderator.Token, valid)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var created store.Webhook
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.NotEmpty(t, created.Secret)
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/webhooks", moderator.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var listed []store.Webhook
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&listed))
+	require.Len(t, listed, 1)
+	require.Empty(t, listed[0].Secret)
+
+	rec = doRequest(t, testAPI, http.MethodGet, "/webhooks/1/deliveries", moderator.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodPost, "/webhooks/1/deliveries/1/replay", moderator.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, testAPI, http.MethodDelete, "/webhooks/1", moderator.Token, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = doRequest(t, testAPI, http.MethodDelete, "/webhooks/1", moderator.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, testAPI, http.MethodGet, "/webhooks/1/deliveries", moderator.Token, nil)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"avtest/internal/store"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriberBuffer = 64
+
+// Broker fans events out to live subscribers of a house.
+type Broker interface {
+	Publish(e store.Event)
+	Subscribe(houseNumber int64) *Subscription
+}
+
+// Subscription receives the events of one house on C. C is closed when the
+// subscriber falls too far behind; it should then resume from the last
+// event it has seen.
+type Subscription struct {
+	C <-chan store.Event
+
+	close func()
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// MemoryBroker is a Broker for a single process.
+type MemoryBroker struct {
+	mu   sync.Mutex
+	subs map[int64]map[chan store.Event]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subs: make(map[int64]map[chan store.Event]struct{}),
+	}
+}
+
+// Publish never blocks: a subscriber that can't keep up is dropped.
+func (b *MemoryBroker) Publish(e store.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[e.HouseNumber] {
+		select {
+		case ch <- e:
+		default:
+			b.remove(e.HouseNumber, ch)
+		}
+	}
+}
+
+// HandleEvent publishes an outbox event, so the broker can be subscribed to
+// the outbox relay.
+func (b *MemoryBroker) HandleEvent(_ context.Context, e store.Event) error {
+	b.Publish(e)
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(houseNumber int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan store.Event, subscriberBuffer)
+	if b.subs[houseNumber] == nil {
+		b.subs[houseNumber] = make(map[chan store.Event]struct{})
+	}
+	b.subs[houseNumber][ch] = struct{}{}
+
+	return &Subscription{
+		C: ch,
+		close: func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.remove(houseNumber, ch)
+		},
+	}
+}
+
+// remove closes the channel unless it was already removed. The caller must
+// hold the lock.
+func (b *MemoryBroker) remove(houseNumber int64, ch chan store.Event) {
+	if _, ok := b.subs[houseNumber][ch]; !ok {
+		return
+	}
+	delete(b.subs[houseNumber], ch)
+	if len(b.subs[houseNumber]) == 0 {
+		delete(b.subs, houseNumber)
+	}
+	close(ch)
+}
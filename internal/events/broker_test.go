@@ -0,0 +1,37 @@
+package events
+
+import (
+	"testing"
+
+	"avtest/internal/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := NewMemoryBroker()
+	first := b.Subscribe(1)
+	other := b.Subscribe(2)
+	defer other.Close()
+
+	b.Publish(store.Event{ID: 1, HouseNumber: 1})
+	require.Equal(t, int64(1), (<-first.C).ID)
+	require.Empty(t, other.C)
+
+	first.Close()
+	first.Close()
+	_, ok := <-first.C
+	require.False(t, ok)
+
+	// A subscriber that doesn't read is dropped instead of blocking.
+	slow := b.Subscribe(1)
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(store.Event{ID: int64(i), HouseNumber: 1})
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	require.Equal(t, subscriberBuffer, n)
+	slow.Close()
+}
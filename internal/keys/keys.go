@@ -0,0 +1,193 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"avtest/internal/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrNoActiveKey          = errors.New("exactly one jwt key must be active")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrKeyExpired           = errors.New("signing key has expired")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	errInvalidKeyConfig     = errors.New("invalid jwt key")
+)
+
+// Key is a loaded signing key.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	ExpiresAt *time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Manager signs tokens with the active key and verifies tokens signed by
+// any configured key, picked by the kid header.
+type Manager struct {
+	active *Key
+	keys   map[string]*Key
+	order  []string
+	now    func() time.Time
+}
+
+func NewManager(jwtKeys []config.JWTKey) (*Manager, error) {
+	m := &Manager{
+		keys: make(map[string]*Key),
+		now:  time.Now,
+	}
+
+	for _, cfg := range jwtKeys {
+		key, err := loadKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", errInvalidKeyConfig, cfg.ID, err)
+		}
+		if _, ok := m.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w %q: duplicate kid", errInvalidKeyConfig, cfg.ID)
+		}
+
+		if cfg.Active {
+			if m.active != nil || key.signKey == nil {
+				return nil, ErrNoActiveKey
+			}
+			m.active = key
+		}
+		m.keys[key.ID] = key
+		m.order = append(m.order, key.ID)
+	}
+
+	if m.active == nil {
+		return nil, ErrNoActiveKey
+	}
+	return m, nil
+}
+
+// Sign signs the claims with the active key and stamps its kid into the
+// token header.
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.Method, claims)
+	token.Header["kid"] = m.active.ID
+	return token.SignedString(m.active.signKey)
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse. Tokens
+// without a kid were issued before key rotation and are checked against the
+// active key.
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := m.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		key, ok = m.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+		}
+	}
+
+	if key.ExpiresAt != nil && m.now().After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: %s", ErrKeyExpired, key.ID)
+	}
+	// The algorithm is fixed per key, so a token can't make us verify an
+	// RSA public key as an HMAC secret.
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("%w: %s for key %s", ErrUnsupportedAlgorithm, token.Method.Alg(), key.ID)
+	}
+	return key.verifyKey, nil
+}
+
+func loadKey(cfg config.JWTKey) (*Key, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+	key := &Key{ID: cfg.ID, ExpiresAt: cfg.ExpiresAt}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, errors.New("secret is required")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.signKey = []byte(cfg.Secret)
+		key.verifyKey = key.signKey
+		return key, nil
+	case "RS256":
+		key.Method = jwt.SigningMethodRS256
+	case "EdDSA":
+		key.Method = SigningMethodEd25519
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, cfg.Algorithm)
+	}
+
+	switch {
+	case cfg.PrivateKeyFile != "":
+		private, err := readPEM(cfg.PrivateKeyFile, parsePrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("key doesn't match algorithm %s", key.Method.Alg())
+		}
+		key.signKey = private
+		key.verifyKey = signer.Public()
+	case cfg.PublicKeyFile != "":
+		public, err := readPEM(cfg.PublicKeyFile, x509.ParsePKIXPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		key.verifyKey = public
+	default:
+		return nil, errors.New("private_key_file or public_key_file is required")
+	}
+
+	if err := checkKeyType(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func readPEM(path string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return parse(block.Bytes)
+}
+
+func parsePrivateKey(der []byte) (interface{}, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// checkKeyType makes sure the PEM file holds a key for the configured
+// algorithm.
+func checkKeyType(key *Key) error {
+	var ok bool
+	switch key.Method {
+	case jwt.SigningMethodRS256:
+		_, ok = key.verifyKey.(*rsa.PublicKey)
+	case SigningMethodEd25519:
+		_, ok = key.verifyKey.(ed25519.PublicKey)
+	}
+	if !ok {
+		return fmt.Errorf("key doesn't match algorithm %s", key.Method.Alg())
+	}
+	return nil
+}
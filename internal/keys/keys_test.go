@@ -0,0 +1,153 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"avtest/internal/config"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaFile := writeRSAKey(t, dir)
+	edFile := writeEd25519Key(t, dir)
+
+	old, err := NewManager([]config.JWTKey{
+		{ID: "hmac", Algorithm: "HS256", Secret: "secret", Active: true},
+	})
+	require.NoError(t, err)
+	oldToken, err := old.Sign(newClaims())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		active config.JWTKey
+	}{
+		{name: "RS256", active: config.JWTKey{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: rsaFile, Active: true}},
+		{name: "EdDSA", active: config.JWTKey{ID: "ed", Algorithm: "EdDSA", PrivateKeyFile: edFile, Active: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewManager([]config.JWTKey{
+				tt.active,
+				{ID: "hmac", Algorithm: "HS256", Secret: "secret"},
+			})
+			require.NoError(t, err)
+
+			token, err := m.Sign(newClaims())
+			require.NoError(t, err)
+
+			parsed, err := jwt.Parse(token, m.Keyfunc)
+			require.NoError(t, err)
+			require.Equal(t, tt.active.ID, parsed.Header["kid"])
+			require.Equal(t, tt.active.Algorithm, parsed.Method.Alg())
+
+			_, err = jwt.Parse(oldToken, m.Keyfunc)
+			require.NoError(t, err, "token signed by a retired key")
+
+			_, err = jwt.Parse(token, old.Keyfunc)
+			require.ErrorIs(t, err.(*jwt.ValidationError).Inner, ErrUnknownKey)
+
+			jwks := m.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			require.Equal(t, tt.active.ID, jwks.Keys[0].KeyID)
+		})
+	}
+}
+
+func TestManager_ExpiredKey(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	old, err := NewManager([]config.JWTKey{
+		{ID: "old", Algorithm: "HS256", Secret: "old", Active: true},
+	})
+	require.NoError(t, err)
+	token, err := old.Sign(newClaims())
+	require.NoError(t, err)
+
+	m, err := NewManager([]config.JWTKey{
+		{ID: "new", Algorithm: "HS256", Secret: "new", Active: true},
+		{ID: "old", Algorithm: "HS256", Secret: "old", ExpiresAt: &expiresAt},
+	})
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(token, m.Keyfunc)
+	require.NoError(t, err)
+
+	m.now = func() time.Time { return expiresAt.Add(time.Second) }
+	_, err = jwt.Parse(token, m.Keyfunc)
+	require.ErrorIs(t, err.(*jwt.ValidationError).Inner, ErrKeyExpired)
+}
+
+func TestManager_AlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager([]config.JWTKey{
+		{ID: "rsa", Algorithm: "RS256", PrivateKeyFile: writeRSAKey(t, dir), Active: true},
+	})
+	require.NoError(t, err)
+
+	// An HS256 token claiming the RSA kid must not be verified with the
+	// public key as the HMAC secret.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims())
+	token.Header["kid"] = "rsa"
+	signed, err := token.SignedString([]byte("anything"))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, m.Keyfunc)
+	require.ErrorIs(t, err.(*jwt.ValidationError).Inner, ErrUnsupportedAlgorithm)
+}
+
+func TestNewManager_InvalidConfig(t *testing.T) {
+	_, err := NewManager(nil)
+	require.ErrorIs(t, err, ErrNoActiveKey)
+
+	_, err = NewManager([]config.JWTKey{
+		{ID: "a", Algorithm: "HS256", Secret: "a", Active: true},
+		{ID: "b", Algorithm: "HS256", Secret: "b", Active: true},
+	})
+	require.ErrorIs(t, err, ErrNoActiveKey)
+
+	_, err = NewManager([]config.JWTKey{
+		{ID: "a", Algorithm: "none", Active: true},
+	})
+	require.Error(t, err)
+}
+
+func newClaims() jwt.Claims {
+	return jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}
+}
+
+func writeRSAKey(t *testing.T, dir string) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return writePEM(t, filepath.Join(dir, "rsa.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func writeEd25519Key(t *testing.T, dir string) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return writePEM(t, filepath.Join(dir, "ed25519.pem"), "PRIVATE KEY", der)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
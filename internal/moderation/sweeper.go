@@ -0,0 +1,56 @@
+package moderation
+
+import (
+	"context"
+	"time"
+
+	"avtest/internal/store"
+
+	"go.uber.org/zap"
+)
+
+// Sweeper periodically returns flats whose moderation lease has expired to
+// the created status, so that another moderator can pick them up.
+type Sweeper struct {
+	logger   *zap.Logger
+	db       store.Database
+	interval time.Duration
+}
+
+func NewSweeper(logger *zap.Logger, db store.Database, interval time.Duration) *Sweeper {
+	return &Sweeper{
+		logger:   logger,
+		db:       db,
+		interval: interval,
+	}
+}
+
+// Run sweeps until the context is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep releases all expired leases once. The releases are audited as made
+// by the system.
+func (s *Sweeper) Sweep(ctx context.Context) {
+	ctx = store.WithAudit(ctx, store.AuditInfo{Role: store.RoleSystem})
+	n, err := s.db.ReleaseExpiredLeases(ctx, time.Now())
+	if err != nil {
+		s.logger.Error("failed to release expired moderation leases", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		s.logger.Info("released expired moderation leases", zap.Int64("count", n))
+	}
+}
@@ -0,0 +1,71 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSweeper(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	now := time.Now()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusCreated}))
+	expired, err := db.ClaimNextFlat(ctx, store.ModerationQueueFilter{}, "moderator", now.Add(-time.Hour), now.Add(-time.Minute))
+	require.NoError(t, err)
+	live, err := db.ClaimNextFlat(ctx, store.ModerationQueueFilter{}, "moderator", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	events, err := db.ListHouseEvents(ctx, 1, 0, 100)
+	require.NoError(t, err)
+	lastEventID := events[len(events)-1].ID
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewSweeper(zap.NewNop(), db, 10*time.Millisecond).Run(runCtx)
+	}()
+	require.Eventually(t, func() bool {
+		f, err := db.GetFlat(ctx, 1, expired.FlatNumber)
+		return err == nil && f.Status == store.StatusCreated
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	f, err := db.GetFlat(ctx, 1, expired.FlatNumber)
+	require.NoError(t, err)
+	require.Empty(t, f.Moderator)
+	require.Nil(t, f.LeaseExpiresAt)
+
+	// Only the expired lease is released.
+	f, err = db.GetFlat(ctx, 1, live.FlatNumber)
+	require.NoError(t, err)
+	require.Equal(t, store.StatusOnModeration, f.Status)
+
+	events, err = db.ListHouseEvents(ctx, 1, lastEventID, 100)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, store.EventFlatStatusChanged, events[0].Type)
+	var released store.Flat
+	require.NoError(t, json.Unmarshal(events[0].Payload, &released))
+	require.Equal(t, expired.FlatNumber, released.FlatNumber)
+	require.Equal(t, store.StatusCreated, released.Status)
+
+	records, err := db.ListAuditRecords(ctx, store.AuditFilter{Entity: store.AuditEntityFlat, EntityID: store.FlatEntityID(1, expired.FlatNumber)})
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	require.Equal(t, store.AuditFlatStatusChanged, records[0].Action)
+	require.Equal(t, store.RoleSystem, records[0].Role)
+	released = store.Flat{}
+	require.NoError(t, json.Unmarshal(records[0].After, &released))
+	require.Equal(t, store.StatusCreated, released.Status)
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"avtest/internal/store"
+
+	"go.uber.org/zap"
+)
+
+// Notifier emails the subscribers of a house about newly approved flats and
+// flats approved again at a lower price. It consumes flat.approved events
+// from the outbox.
+type Notifier struct {
+	logger *zap.Logger
+	db     store.Database
+	sender Sender
+
+	// priceDropPercent is how much cheaper, in percent of the last approved
+	// price, a flat has to get for subscribers to hear about the drop.
+	priceDropPercent int
+}
+
+func NewNotifier(logger *zap.Logger, db store.Database, sender Sender, priceDropPercent int) *Notifier {
+	return &Notifier{
+		logger:           logger,
+		db:               db,
+		sender:           sender,
+		priceDropPercent: priceDropPercent,
+	}
+}
+
+// HandleEvent notifies subscribers when a flat is approved. Edited flats go
+// back to moderation, so a price drop is announced once the flat is
+// approved again and subscribers can see it. A failed lookup of subscribers
+// is returned so the event is retried; failed sends are only logged,
+// retrying would mail everyone else again. Failures of other consumers of
+// the event don't bring it back here.
+func (n *Notifier) HandleEvent(ctx context.Context, e store.Event) error {
+	if e.Type != store.EventFlatApproved {
+		return nil
+	}
+
+	var approval store.FlatApproval
+	if err := json.Unmarshal(e.Payload, &approval); err != nil {
+		n.logger.Error("failed to decode flat event", zap.Int64("id", e.ID), zap.Error(err))
+		return nil
+	}
+	if n.isPriceDrop(approval) {
+		return n.notifyHouse(ctx, approval.HouseNumber, priceDropMessage(approval))
+	}
+	return n.notifyHouse(ctx, approval.HouseNumber, flatApprovedMessage(approval.Flat))
+}
+
+// isPriceDrop reports whether the flat was approved before and its price
+// fell by more than priceDropPercent since.
+func (n *Notifier) isPriceDrop(approval store.FlatApproval) bool {
+	previous := approval.PreviousApprovedPrice
+	if previous == 0 || approval.Price >= previous {
+		return false
+	}
+	drop := int64(previous - approval.Price)
+	return drop*100 > int64(previous)*int64(n.priceDropPercent)
+}
+
+// notifyHouse sends the message to every subscriber of the house.
+func (n *Notifier) notifyHouse(ctx context.Context, houseNumber int64, msg Message) error {
+	emails, err := n.db.GetHouseSubscribers(ctx, houseNumber)
+	if err != nil {
+		return fmt.Errorf("get subscribers of house %d: %w", houseNumber, err)
+	}
+
+	for _, email := range emails {
+		msg.To = email
+		if err := n.sender.Send(ctx, msg); err != nil {
+			n.logger.Error("failed to send notification", zap.String("to", email), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func flatApprovedMessage(flat store.Flat) Message {
+	return Message{
+		Subject: fmt.Sprintf("Новая квартира в доме %d", flat.HouseNumber),
+		Body: fmt.Sprintf("В доме %d появилась квартира %d: %d комн., цена %d.",
+			flat.HouseNumber, flat.FlatNumber, flat.Rooms, flat.Price),
+	}
+}
+
+func priceDropMessage(approval store.FlatApproval) Message {
+	return Message{
+		Subject: fmt.Sprintf("Квартира в доме %d подешевела", approval.HouseNumber),
+		Body: fmt.Sprintf("Цена квартиры %d в доме %d снизилась с %d до %d.",
+			approval.FlatNumber, approval.HouseNumber, approval.PreviousApprovedPrice, approval.Price),
+	}
+}
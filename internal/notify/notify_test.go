@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type recordingSender struct {
+	sent []Message
+}
+
+func (s *recordingSender) Send(_ context.Context, msg Message) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func TestNotifierNotify(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 2, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateSubscription(ctx, &store.Subscription{Email: "first@mail.ru", HouseNumber: 1}))
+	require.NoError(t, db.CreateSubscription(ctx, &store.Subscription{Email: "second@mail.ru", HouseNumber: 1}))
+	require.NoError(t, db.CreateSubscription(ctx, &store.Subscription{Email: "other@mail.ru", HouseNumber: 2}))
+
+	sender := &recordingSender{}
+	n := NewNotifier(zap.NewNop(), db, sender, 10)
+	event, err := store.NewFlatEvent(store.EventFlatApproved, store.Flat{HouseNumber: 1, FlatNumber: 7, Price: 100, Rooms: 2}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, n.HandleEvent(context.Background(), event))
+
+	require.Len(t, sender.sent, 2)
+	require.Equal(t, "first@mail.ru", sender.sent[0].To)
+	require.Equal(t, "second@mail.ru", sender.sent[1].To)
+	require.Contains(t, sender.sent[0].Body, "7")
+
+	// Other events don't notify anyone.
+	event.Type = store.EventFlatStatusChanged
+	require.NoError(t, n.HandleEvent(context.Background(), event))
+	require.Len(t, sender.sent, 2)
+}
+
+func TestNotifierPriceDrop(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateSubscription(ctx, &store.Subscription{Email: "first@mail.ru", HouseNumber: 1}))
+
+	sender := &recordingSender{}
+	n := NewNotifier(zap.NewNop(), db, sender, 10)
+
+	tests := []struct {
+		name          string
+		approvedPrice int
+		price         int
+		drop          bool
+	}{
+		{name: "large drop", approvedPrice: 1000, price: 850, drop: true},
+		{name: "drop of exactly the threshold", approvedPrice: 1000, price: 900},
+		{name: "small drop", approvedPrice: 1000, price: 950},
+		{name: "rise", approvedPrice: 1000, price: 2000},
+		{name: "first approval", price: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender.sent = nil
+			flat := store.Flat{HouseNumber: 1, FlatNumber: 7, Price: tt.price, Status: store.StatusApproved}
+			event, err := store.NewFlatStatusEvent(flat, store.Flat{ApprovedPrice: tt.approvedPrice}, time.Now())
+			require.NoError(t, err)
+			require.NoError(t, n.HandleEvent(ctx, event))
+
+			// Subscribers hear about every approval, and about the drop if
+			// the flat is cheaper enough than when it was last approved.
+			require.Len(t, sender.sent, 1)
+			require.Equal(t, "first@mail.ru", sender.sent[0].To)
+			if tt.drop {
+				require.Contains(t, sender.sent[0].Body, "с 1000 до 850")
+			} else {
+				require.NotContains(t, sender.sent[0].Subject, "подешевела")
+			}
+		})
+	}
+
+	// Price edits themselves don't notify anyone: the flat is back on
+	// moderation and subscribers can't see it.
+	sender.sent = nil
+	event, err := store.NewFlatPriceEvent(store.Flat{HouseNumber: 1, FlatNumber: 7, Price: 500, Status: store.StatusCreated},
+		store.Flat{Price: 1000, Status: store.StatusApproved}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, n.HandleEvent(ctx, event))
+	require.Empty(t, sender.sent)
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	sender := NewFileSender(path)
+
+	require.NoError(t, sender.Send(context.Background(), Message{To: "first@mail.ru", Subject: "first", Body: "hello"}))
+	require.NoError(t, sender.Send(context.Background(), Message{To: "second@mail.ru", Subject: "second", Body: "hello"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "To: first@mail.ru")
+	require.Contains(t, string(data), "To: second@mail.ru")
+}
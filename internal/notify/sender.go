@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"avtest/internal/config"
+
+	"go.uber.org/zap"
+)
+
+var ErrUnknownSender = errors.New("unknown notification sender")
+
+// Message is an email to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages to subscribers.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPSender sends messages through an SMTP relay.
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSender returns a sender for the relay at addr (host:port). The
+// username and password may be empty for relays that don't authenticate.
+func NewSMTPSender(addr, from, username, password string) *SMTPSender {
+	s := &SMTPSender{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, formatMessage(s.from, msg))
+}
+
+// LogSender only logs messages. It is meant for local runs.
+type LogSender struct {
+	logger *zap.Logger
+}
+
+func NewLogSender(logger *zap.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(_ context.Context, msg Message) error {
+	s.logger.Info("notification",
+		zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("body", msg.Body))
+	return nil
+}
+
+// FileSender appends messages to a file, one after another, so that local
+// runs and tests can check what would have been sent.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(formatMessage("", msg), '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// NewSender builds the sender chosen in the config.
+func NewSender(cfg *config.Config, logger *zap.Logger) (Sender, error) {
+	switch cfg.NotifySender {
+	case "log":
+		return NewLogSender(logger), nil
+	case "file":
+		return NewFileSender(cfg.NotifyFile), nil
+	case "smtp":
+		return NewSMTPSender(cfg.SMTPAddr, cfg.SMTPFrom, cfg.SMTPUsername, cfg.SMTPPassword), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSender, cfg.NotifySender)
+	}
+}
+
+func formatMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", from)
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(msg.Body)
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
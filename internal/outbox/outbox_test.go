@@ -0,0 +1,210 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"avtest/internal/config"
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestRelay(db store.Database, publisher Publisher, now *time.Time) *Relay {
+	r := NewRelay(zap.NewNop(), db, publisher, &config.Config{
+		OutboxBatchSize:      10,
+		OutboxPublishTimeout: time.Second,
+		OutboxMaxAttempts:    3,
+		OutboxRetryBackoff:   time.Minute,
+	})
+	r.now = func() time.Time { return *now }
+	return r
+}
+
+func TestRelayDelivers(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+
+	var got []string
+	inProcess := NewInProcessPublisher()
+	inProcess.Subscribe("test", func(_ context.Context, e store.Event) error {
+		got = append(got, e.Type)
+		return nil
+	})
+
+	now := time.Now()
+	relay := newTestRelay(db, inProcess, &now)
+	require.Equal(t, 2, relay.RelayOnce(context.Background()))
+	require.Equal(t, []string{store.EventHouseCreated, store.EventFlatCreated}, got)
+
+	// Published events are not delivered again.
+	now = now.Add(time.Hour)
+	require.Zero(t, relay.RelayOnce(context.Background()))
+}
+
+func TestRelayRetries(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+
+	var calls int
+	failing := Fanout{{Name: "failing", Publisher: publisherFunc(func(context.Context, store.Event) error {
+		calls++
+		return errors.New("unavailable")
+	})}}
+
+	now := time.Now()
+	relay := newTestRelay(db, failing, &now)
+	require.Equal(t, 1, relay.RelayOnce(context.Background()))
+
+	// Not due before the backoff passes, then retried with a doubled delay.
+	now = now.Add(30 * time.Second)
+	require.Zero(t, relay.RelayOnce(context.Background()))
+	now = now.Add(time.Minute)
+	require.Equal(t, 1, relay.RelayOnce(context.Background()))
+	now = now.Add(time.Minute)
+	require.Zero(t, relay.RelayOnce(context.Background()))
+	now = now.Add(time.Minute)
+	require.Equal(t, 1, relay.RelayOnce(context.Background()))
+
+	// The third failure makes the event dead.
+	now = now.Add(24 * time.Hour)
+	require.Zero(t, relay.RelayOnce(context.Background()))
+	require.Equal(t, 3, calls)
+}
+
+func TestRelayRetriesFailedPublishersOnly(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+
+	// The notifier and the webhook publisher succeed, the dispatcher and
+	// the log publisher fail once.
+	calls := make(map[string]int)
+	failOnce := func(name string) error {
+		calls[name]++
+		if calls[name] == 1 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+	inProcess := NewInProcessPublisher()
+	inProcess.Subscribe("notify", func(context.Context, store.Event) error {
+		calls["notify"]++
+		return nil
+	})
+	inProcess.Subscribe("webhooks", func(context.Context, store.Event) error {
+		return failOnce("webhooks")
+	})
+	publishers := Fanout{
+		{Name: "in_process", Publisher: inProcess},
+		{Name: "webhook", Publisher: publisherFunc(func(context.Context, store.Event) error {
+			calls["webhook"]++
+			return nil
+		})},
+		{Name: "log", Publisher: publisherFunc(func(context.Context, store.Event) error {
+			return failOnce("log")
+		})},
+	}
+
+	now := time.Now()
+	relay := newTestRelay(db, publishers, &now)
+	require.Equal(t, 1, relay.RelayOnce(ctx))
+	now = now.Add(time.Minute)
+	require.Equal(t, 1, relay.RelayOnce(ctx))
+
+	// The retry only went to the consumers that failed, and then the event
+	// was published.
+	require.Equal(t, map[string]int{"notify": 1, "webhooks": 2, "webhook": 1, "log": 2}, calls)
+	now = now.Add(time.Hour)
+	require.Zero(t, relay.RelayOnce(ctx))
+}
+
+func TestRelayWake(t *testing.T) {
+	db := memory.NewMemoryDB()
+	delivered := make(chan store.Event, 1)
+	inProcess := NewInProcessPublisher()
+	inProcess.Subscribe("test", func(_ context.Context, e store.Event) error {
+		delivered <- e
+		return nil
+	})
+
+	relay := NewRelay(zap.NewNop(), db, inProcess, &config.Config{
+		OutboxPollInterval:   time.Hour,
+		OutboxBatchSize:      10,
+		OutboxPublishTimeout: time.Second,
+		OutboxMaxAttempts:    3,
+		OutboxRetryBackoff:   time.Minute,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	// Without a wake up the event would wait for the next poll in an hour.
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	relay.Wake()
+	relay.Wake()
+
+	select {
+	case e := <-delivered:
+		require.Equal(t, store.EventHouseCreated, e.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not relayed after wake up")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestRelayBackoff(t *testing.T) {
+	now := time.Now()
+	relay := newTestRelay(memory.NewMemoryDB(), Fanout{}, &now)
+
+	require.Equal(t, time.Minute, relay.backoff(1))
+	require.Equal(t, 2*time.Minute, relay.backoff(2))
+	require.Equal(t, 4*time.Minute, relay.backoff(3))
+	require.Equal(t, maxRetryBackoff, relay.backoff(30))
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var received store.Event
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	event, err := store.NewFlatEvent(store.EventFlatApproved, store.Flat{ID: 5, HouseNumber: 1, FlatNumber: 2}, time.Now())
+	require.NoError(t, err)
+	event.ID = 42
+
+	publisher := NewWebhookPublisher(srv.URL, srv.Client())
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	require.Equal(t, int64(42), received.ID)
+	require.Equal(t, store.EventFlatApproved, received.Type)
+
+	status = http.StatusInternalServerError
+	require.Error(t, publisher.Publish(context.Background(), event))
+}
+
+type publisherFunc func(ctx context.Context, e store.Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, e store.Event) error {
+	return f(ctx, e)
+}
@@ -0,0 +1,213 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"avtest/internal/config"
+	"avtest/internal/store"
+
+	"go.uber.org/zap"
+)
+
+var ErrUnknownPublisher = errors.New("unknown outbox publisher")
+
+// Publisher delivers outbox events. An error makes the relay retry the event
+// later, so publishers and their consumers must tolerate duplicates. A
+// publisher that reached some of its consumers returns a *PartialError, and
+// skips the consumers named in the event's DeliveredTo on the retry.
+type Publisher interface {
+	Publish(ctx context.Context, e store.Event) error
+}
+
+// PartialError reports an event that reached some consumers but not all.
+// DeliveredTo names every consumer that has the event so far.
+type PartialError struct {
+	DeliveredTo []string
+	Err         error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// deliveredTo returns the consumers that have the event after a publish
+// that returned err.
+func deliveredTo(e store.Event, err error) []string {
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		return partial.DeliveredTo
+	}
+	return e.DeliveredTo
+}
+
+// Handler consumes events published in process.
+type Handler func(ctx context.Context, e store.Event) error
+
+type namedHandler struct {
+	name    string
+	handler Handler
+}
+
+// InProcessPublisher hands events to handlers running in this process.
+type InProcessPublisher struct {
+	mu       sync.RWMutex
+	handlers []namedHandler
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+// Subscribe adds a handler called for every event. Deliveries to the
+// handler are tracked under name, which must be unique among the consumers
+// of the relay.
+func (p *InProcessPublisher) Subscribe(name string, h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers = append(p.handlers, namedHandler{name: name, handler: h})
+}
+
+// Publish calls the handlers that don't have the event yet. Only the failed
+// ones are called again when the event is retried.
+func (p *InProcessPublisher) Publish(ctx context.Context, e store.Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	delivered := slices.Clone(e.DeliveredTo)
+	var errs []error
+	for _, h := range p.handlers {
+		if slices.Contains(e.DeliveredTo, h.name) {
+			continue
+		}
+		if err := h.handler(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		delivered = append(delivered, h.name)
+	}
+	if len(errs) > 0 {
+		return &PartialError{DeliveredTo: delivered, Err: errors.Join(errs...)}
+	}
+	return nil
+}
+
+// LogPublisher logs events. It is meant for local runs and debugging.
+type LogPublisher struct {
+	logger *zap.Logger
+}
+
+func NewLogPublisher(logger *zap.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(_ context.Context, e store.Event) error {
+	p.logger.Info("event",
+		zap.Int64("id", e.ID), zap.String("type", e.Type), zap.Int64("house_number", e.HouseNumber),
+		zap.ByteString("payload", e.Payload))
+	return nil
+}
+
+// WebhookPublisher posts events as JSON to a URL. Any response other than
+// 2xx counts as a failure.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookPublisher(url string, client *http.Client) *WebhookPublisher {
+	return &WebhookPublisher{url: url, client: client}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, e store.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", fmt.Sprint(e.ID))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// NamedPublisher is a publisher of a Fanout. Deliveries to it are tracked
+// under Name.
+type NamedPublisher struct {
+	Name string
+	Publisher
+}
+
+// Fanout publishes every event to all its publishers. When some of them
+// fail, a retry goes only to those, so one unreachable publisher doesn't
+// make the others deliver the event again.
+type Fanout []NamedPublisher
+
+func (f Fanout) Publish(ctx context.Context, e store.Event) error {
+	delivered := slices.Clone(e.DeliveredTo)
+	var errs []error
+	for _, p := range f {
+		if slices.Contains(e.DeliveredTo, p.Name) {
+			continue
+		}
+		err := p.Publish(ctx, e)
+		if err == nil {
+			delivered = append(delivered, p.Name)
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		for _, name := range deliveredTo(e, err) {
+			if !slices.Contains(delivered, name) {
+				delivered = append(delivered, name)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &PartialError{DeliveredTo: delivered, Err: errors.Join(errs...)}
+	}
+	return nil
+}
+
+// NewPublishers builds the publishers listed in the config, in addition to
+// the in-process one which is always used.
+func NewPublishers(cfg *config.Config, logger *zap.Logger, inProcess *InProcessPublisher) (Fanout, error) {
+	publishers := Fanout{{Name: "in_process", Publisher: inProcess}}
+	for _, name := range strings.Split(cfg.OutboxPublishers, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "log":
+			publishers = append(publishers, NamedPublisher{Name: name, Publisher: NewLogPublisher(logger)})
+		case "webhook":
+			publishers = append(publishers, NamedPublisher{Name: name,
+				Publisher: NewWebhookPublisher(cfg.OutboxWebhookURL, &http.Client{Timeout: cfg.OutboxPublishTimeout})})
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrUnknownPublisher, name)
+		}
+	}
+	return publishers, nil
+}
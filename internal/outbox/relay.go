@@ -0,0 +1,135 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"avtest/internal/config"
+	"avtest/internal/store"
+
+	"go.uber.org/zap"
+)
+
+const maxRetryBackoff = time.Hour
+
+// Relay publishes events from the outbox. Every event is delivered at least
+// once: failed deliveries are retried with exponential backoff until the
+// event runs out of attempts and is marked dead. Retries skip the consumers
+// that already have the event.
+type Relay struct {
+	logger    *zap.Logger
+	db        store.Database
+	publisher Publisher
+
+	interval       time.Duration
+	batchSize      int
+	maxAttempts    int
+	retryBackoff   time.Duration
+	publishTimeout time.Duration
+
+	wake chan struct{}
+	now  func() time.Time
+}
+
+func NewRelay(logger *zap.Logger, db store.Database, publisher Publisher, cfg *config.Config) *Relay {
+	return &Relay{
+		logger:         logger,
+		db:             db,
+		publisher:      publisher,
+		interval:       cfg.OutboxPollInterval,
+		batchSize:      cfg.OutboxBatchSize,
+		maxAttempts:    cfg.OutboxMaxAttempts,
+		retryBackoff:   cfg.OutboxRetryBackoff,
+		publishTimeout: cfg.OutboxPublishTimeout,
+		wake:           make(chan struct{}, 1),
+		now:            time.Now,
+	}
+}
+
+// Wake makes Run relay right away instead of waiting for the next poll.
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays events until the context is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while there is a backlog.
+		for ctx.Err() == nil {
+			if n := r.RelayOnce(ctx); n < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of due events and reports how many were
+// claimed.
+func (r *Relay) RelayOnce(ctx context.Context) int {
+	now := r.now()
+	// The claim has to outlast publishing the whole batch one by one. An
+	// event whose delivery outlives it anyway may be published twice,
+	// which at-least-once delivery allows.
+	claimUntil := now.Add(r.publishTimeout * time.Duration(r.batchSize+1))
+	events, err := r.db.ClaimOutboxEvents(ctx, now, claimUntil, r.batchSize)
+	if err != nil {
+		r.logger.Error("failed to claim outbox events", zap.Error(err))
+		return 0
+	}
+
+	for _, e := range events {
+		r.publish(ctx, e)
+	}
+	return len(events)
+}
+
+func (r *Relay) publish(ctx context.Context, e store.Event) {
+	publishCtx, cancel := context.WithTimeout(ctx, r.publishTimeout)
+	err := r.publisher.Publish(publishCtx, e)
+	cancel()
+
+	if err == nil {
+		if err := r.db.MarkEventPublished(ctx, e.ID, r.now()); err != nil {
+			r.logger.Error("failed to mark event published", zap.Int64("id", e.ID), zap.Error(err))
+		}
+		return
+	}
+
+	attempts := e.Attempts + 1
+	dead := attempts >= r.maxAttempts
+	if dead {
+		r.logger.Error("giving up on event", zap.Int64("id", e.ID), zap.String("type", e.Type),
+			zap.Int("attempts", attempts), zap.Error(err))
+	} else {
+		r.logger.Warn("failed to publish event", zap.Int64("id", e.ID), zap.String("type", e.Type),
+			zap.Int("attempts", attempts), zap.Error(err))
+	}
+
+	nextAttemptAt := r.now().Add(r.backoff(attempts))
+	if err := r.db.MarkEventFailed(ctx, e.ID, err.Error(), nextAttemptAt, dead, deliveredTo(e, err)); err != nil {
+		r.logger.Error("failed to mark event failed", zap.Int64("id", e.ID), zap.Error(err))
+	}
+}
+
+// backoff returns the delay before the next attempt after the given number
+// of failed ones.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.retryBackoff
+	for i := 1; i < attempts && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
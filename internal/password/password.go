@@ -0,0 +1,70 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCost = errors.New("invalid bcrypt cost")
+
+// Hasher hashes and verifies passwords with bcrypt.
+type Hasher struct {
+	cost int
+
+	// dummyHash is compared against when a user doesn't exist, so that
+	// a failed login takes the same time whether or not the email is known.
+	dummyHash []byte
+}
+
+func NewHasher(cost int) (*Hasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidCost, cost)
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), cost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hasher{cost: cost, dummyHash: dummyHash}, nil
+}
+
+// Hash returns the bcrypt hash of the password.
+func (h *Hasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether the password matches the hash. The comparison is
+// constant-time.
+func (h *Hasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// VerifyDummy burns the same amount of time as Verify for a missing user.
+func (h *Hasher) VerifyDummy(password string) {
+	_ = bcrypt.CompareHashAndPassword(h.dummyHash, []byte(password))
+}
+
+// NeedsRehash reports whether the hash was made with other parameters than
+// the hasher is configured with.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+// IsHash reports whether the stored value looks like a bcrypt hash rather
+// than a plaintext password.
+func IsHash(s string) bool {
+	if !strings.HasPrefix(s, "$2a$") && !strings.HasPrefix(s, "$2b$") && !strings.HasPrefix(s, "$2y$") {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(s))
+	return err == nil
+}
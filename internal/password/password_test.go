@@ -0,0 +1,32 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasher(t *testing.T) {
+	h, err := NewHasher(bcrypt.MinCost)
+	require.NoError(t, err)
+
+	hash, err := h.Hash("secret")
+	require.NoError(t, err)
+	require.NotEqual(t, "secret", hash)
+	require.True(t, IsHash(hash))
+	require.False(t, IsHash("secret"))
+
+	require.True(t, h.Verify(hash, "secret"))
+	require.False(t, h.Verify(hash, "wrong"))
+	require.False(t, h.Verify("secret", "secret"))
+	require.False(t, h.NeedsRehash(hash))
+
+	stronger, err := NewHasher(bcrypt.MinCost + 1)
+	require.NoError(t, err)
+	require.True(t, stronger.NeedsRehash(hash))
+	require.True(t, stronger.Verify(hash, "secret"))
+
+	_, err = NewHasher(bcrypt.MaxCost + 1)
+	require.ErrorIs(t, err, ErrInvalidCost)
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditUserRegistered       = "user.registered"
+	AuditUserLoggedIn         = "user.logged_in"
+	AuditUserLoggedOut        = "user.logged_out"
+	AuditUserLoggedOutAll     = "user.logged_out_all"
+	AuditUserTokenRefreshed   = "user.token_refreshed"
+	AuditUserTokenReused      = "user.token_reused"
+	AuditUserPasswordRehashed = "user.password_rehashed"
+	AuditUserUpdated          = "user.updated"
+	AuditUserPasswordReset    = "user.password_reset"
+
+	AuditInvitationCreated = "invitation.created"
+
+	AuditHouseCreated = "house.created"
+	AuditHouseUpdated = "house.updated"
+	AuditHouseDeleted = "house.deleted"
+
+	AuditFlatCreated       = "flat.created"
+	AuditFlatStatusChanged = "flat.status_changed"
+	AuditFlatUpdated       = "flat.updated"
+	AuditFlatArchived      = "flat.archived"
+
+	AuditSubscriptionCreated = "subscription.created"
+	AuditSubscriptionDeleted = "subscription.deleted"
+
+	AuditWebhookCreated          = "webhook.created"
+	AuditWebhookDeleted          = "webhook.deleted"
+	AuditWebhookDeliveryReplayed = "webhook.delivery_replayed"
+)
+
+// Audited entities.
+const (
+	AuditEntityUser         = "user"
+	AuditEntityHouse        = "house"
+	AuditEntityFlat         = "flat"
+	AuditEntitySubscription = "subscription"
+	AuditEntityWebhook      = "webhook"
+	AuditEntityInvitation   = "invitation"
+)
+
+// FlatEntityID identifies a flat in the audit log.
+func FlatEntityID(houseNumber, flatNumber int64) string {
+	return fmt.Sprintf("%d/%d", houseNumber, flatNumber)
+}
+
+// AuditRecord tells who changed an entity, when and how. Records are only
+// ever added. Changes of houses and flats are recorded in the same
+// transaction as the change.
+type AuditRecord struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Role      string          `json:"role"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects audit records, newest first. Zero fields don't
+// filter.
+type AuditFilter struct {
+	Actor     string
+	Action    string
+	Entity    string
+	EntityID  string
+	RequestID string
+	// From and To bound the creation time, To excluded.
+	From time.Time
+	To   time.Time
+
+	// BeforeID continues the listing past the record a previous page
+	// ended with.
+	BeforeID int64
+	Limit    int
+}
+
+// Matches reports whether the record belongs to the listing, ignoring the
+// page boundaries.
+func (f AuditFilter) Matches(r AuditRecord) bool {
+	switch {
+	case f.Actor != "" && r.Actor != f.Actor:
+	case f.Action != "" && r.Action != f.Action:
+	case f.Entity != "" && r.Entity != f.Entity:
+	case f.EntityID != "" && r.EntityID != f.EntityID:
+	case f.RequestID != "" && r.RequestID != f.RequestID:
+	case !f.From.IsZero() && r.CreatedAt.Before(f.From):
+	case !f.To.IsZero() && !r.CreatedAt.Before(f.To):
+	default:
+		return true
+	}
+	return false
+}
+
+// AuditInfo is who makes the changes of a request, as recorded in the audit
+// log.
+type AuditInfo struct {
+	Actor     string
+	Role      string
+	RequestID string
+}
+
+type auditInfoKey struct{}
+
+// WithAudit returns a context whose writes are audited with info.
+func WithAudit(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// AuditFrom returns the audit info of the context.
+func AuditFrom(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	return info
+}
+
+// NewAuditRecord returns a record of the entity changing from before to
+// after on behalf of the actor of ctx. Either may be nil.
+func NewAuditRecord(ctx context.Context, action, entity, entityID string, before, after interface{}, at time.Time) (AuditRecord, error) {
+	info := AuditFrom(ctx)
+	record := AuditRecord{
+		Actor:     info.Actor,
+		Role:      info.Role,
+		Action:    action,
+		Entity:    entity,
+		EntityID:  entityID,
+		RequestID: info.RequestID,
+		CreatedAt: at,
+	}
+
+	var err error
+	if before != nil {
+		if record.Before, err = json.Marshal(before); err != nil {
+			return AuditRecord{}, err
+		}
+	}
+	if after != nil {
+		if record.After, err = json.Marshal(after); err != nil {
+			return AuditRecord{}, err
+		}
+	}
+	return record, nil
+}
+
+// NewUserAuditRecord returns a record of the user changing from before to
+// after. Password hashes are left out.
+func NewUserAuditRecord(ctx context.Context, action string, before, after User, at time.Time) (AuditRecord, error) {
+	return NewAuditRecord(ctx, action, AuditEntityUser, strconv.FormatInt(before.ID, 10),
+		before.Profile(), after.Profile(), at)
+}
+
+// NewRegistrationAuditRecord returns the user.registered record of the new
+// user. Users registering themselves, with no role in ctx, are recorded as
+// their own actors.
+func NewRegistrationAuditRecord(ctx context.Context, u User, at time.Time) (AuditRecord, error) {
+	id := strconv.FormatInt(u.ID, 10)
+	if info := AuditFrom(ctx); info.Role == "" {
+		info.Actor, info.Role = id, u.Type
+		ctx = WithAudit(ctx, info)
+	}
+	return NewAuditRecord(ctx, AuditUserRegistered, AuditEntityUser, id, nil, u.Profile(), at)
+}
+
+// NewWebhookAuditRecord returns a record of the webhook changing from before
+// to after. Either may be nil, but not both. The secret is left out.
+func NewWebhookAuditRecord(ctx context.Context, action string, before, after *Webhook, at time.Time) (AuditRecord, error) {
+	w := after
+	if before != nil {
+		w = before
+	}
+	return NewAuditRecord(ctx, action, AuditEntityWebhook, strconv.FormatInt(w.ID, 10),
+		auditedWebhook(before), auditedWebhook(after), at)
+}
+
+// NewFlatAuditRecord returns a record of the flat changing from before to
+// after. Either may be nil, but not both. The moderator is left out; the
+// actor of the record tells who reviewed the flat.
+func NewFlatAuditRecord(ctx context.Context, action string, before, after *Flat, at time.Time) (AuditRecord, error) {
+	f := after
+	if before != nil {
+		f = before
+	}
+	return NewAuditRecord(ctx, action, AuditEntityFlat, FlatEntityID(f.HouseNumber, f.FlatNumber),
+		auditedFlat(before), auditedFlat(after), at)
+}
+
+// auditedFlat returns the flat as stored in the audit log. A nil flat is
+// left out of the record rather than stored as JSON null.
+func auditedFlat(f *Flat) interface{} {
+	if f == nil {
+		return nil
+	}
+	audited := *f
+	audited.Moderator = ""
+	return audited
+}
+
+// auditedWebhook returns the webhook as stored in the audit log, without its
+// secret.
+func auditedWebhook(w *Webhook) interface{} {
+	if w == nil {
+		return nil
+	}
+	audited := *w
+	audited.Secret = ""
+	return audited
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrHouseExists   = errors.New("house already exists")
+	ErrHouseNotFound = errors.New("house not found")
+	ErrFlatNotFound  = errors.New("flat not found")
+	ErrLeaseNotHeld  = errors.New("moderation lease is not held by this moderator")
+
+	ErrFlatModeratedByOther = errors.New("another moderator has already been assigned to this flat")
+	ErrLeaseExpired         = errors.New("moderation lease has expired")
+	ErrFlatOnModeration     = errors.New("flat is on moderation")
+	ErrNotFlatOwner         = errors.New("flat belongs to another user")
+
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+	ErrInvitationInvalid = errors.New("invitation is unknown, used, expired or for another email")
+
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// VersionConflictError is returned when a write was based on a version of a
+// record that has since changed. It wraps ErrVersionConflict.
+type VersionConflictError struct {
+	Entity   string
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: %s is at version %d, not %d", ErrVersionConflict, e.Entity, e.Actual, e.Expected)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// CheckVersion fails with a VersionConflictError unless the record is at the
+// expected version. An expected version of zero matches any.
+func CheckVersion(entity string, expected, actual int64) error {
+	if expected == 0 || expected == actual {
+		return nil
+	}
+	return &VersionConflictError{Entity: entity, Expected: expected, Actual: actual}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types written to the outbox.
+const (
+	EventHouseCreated      = "house.created"
+	EventFlatCreated       = "flat.created"
+	EventFlatStatusChanged = "flat.status_changed"
+	EventFlatApproved      = "flat.approved"
+	EventFlatUpdated       = "flat.updated"
+	EventFlatArchived      = "flat.archived"
+	EventFlatPriceChanged  = "flat.price_changed"
+)
+
+// EventTypes lists every event type, in the order of the constants above.
+var EventTypes = []string{EventHouseCreated, EventFlatCreated, EventFlatStatusChanged, EventFlatApproved,
+	EventFlatUpdated, EventFlatArchived, EventFlatPriceChanged}
+
+// Outbox event states.
+const (
+	EventPending   = "pending"
+	EventPublished = "published"
+	EventDead      = "dead"
+)
+
+// Event is a domain event recorded in the outbox together with the change
+// that caused it, and published later by the relay.
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	HouseNumber int64           `json:"house_number"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+
+	Status        string     `json:"-"`
+	Attempts      int        `json:"-"`
+	NextAttemptAt time.Time  `json:"-"`
+	LastError     string     `json:"-"`
+	PublishedAt   *time.Time `json:"-"`
+	// DeliveredTo names the publishers and in-process consumers that have
+	// the event, so that retries skip them.
+	DeliveredTo []string `json:"-"`
+}
+
+// NewHouseEvent returns an event carrying the house.
+func NewHouseEvent(eventType string, house House, at time.Time) (Event, error) {
+	return newEvent(eventType, house.HouseNumber, house, at)
+}
+
+// NewFlatEvent returns an event carrying the flat. The moderator is left out,
+// events are not meant to identify who reviews a flat.
+func NewFlatEvent(eventType string, flat Flat, at time.Time) (Event, error) {
+	flat.Moderator = ""
+	return newEvent(eventType, flat.HouseNumber, flat, at)
+}
+
+// FlatPriceChange is the payload of flat.price_changed events: the flat
+// after the change and the price and status it had before.
+type FlatPriceChange struct {
+	Flat
+	PreviousPrice  int    `json:"previous_price"`
+	PreviousStatus string `json:"previous_status"`
+}
+
+// NewFlatPriceEvent returns a flat.price_changed event for a flat that was
+// previous before the change.
+func NewFlatPriceEvent(flat, previous Flat, at time.Time) (Event, error) {
+	flat.Moderator = ""
+	change := FlatPriceChange{Flat: flat, PreviousPrice: previous.Price, PreviousStatus: previous.Status}
+	return newEvent(EventFlatPriceChanged, flat.HouseNumber, change, at)
+}
+
+// FlatApproval is the payload of flat.approved events: the flat and the
+// price it had when it was approved the time before, if it ever was.
+type FlatApproval struct {
+	Flat
+	PreviousApprovedPrice int `json:"previous_approved_price,omitempty"`
+}
+
+// NewFlatStatusEvent returns the event of a status change of a flat that was
+// previous before the change.
+func NewFlatStatusEvent(flat, previous Flat, at time.Time) (Event, error) {
+	if flat.Status != StatusApproved {
+		return NewFlatEvent(EventFlatStatusChanged, flat, at)
+	}
+	flat.Moderator = ""
+	approval := FlatApproval{Flat: flat, PreviousApprovedPrice: previous.ApprovedPrice}
+	return newEvent(EventFlatApproved, flat.HouseNumber, approval, at)
+}
+
+func newEvent(eventType string, houseNumber int64, v interface{}, at time.Time) (Event, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Type:          eventType,
+		HouseNumber:   houseNumber,
+		Payload:       payload,
+		CreatedAt:     at,
+		Status:        EventPending,
+		NextAttemptAt: at,
+	}, nil
+}
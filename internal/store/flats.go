@@ -0,0 +1,160 @@
+package store
+
+import "time"
+
+// Keys flat listings can be sorted by.
+const (
+	SortByFlatNumber = "flat_number"
+	SortByPrice      = "price"
+	SortByRooms      = "rooms"
+)
+
+// FlatQuery selects a page of the flats of a house. Zero fields don't
+// filter.
+type FlatQuery struct {
+	// Role decides visibility, see SeesAllFlats.
+	Role string
+
+	MinPrice      int
+	MaxPrice      int
+	Rooms         int
+	Status        string
+	MinFlatNumber int64
+	MaxFlatNumber int64
+
+	// SortBy is one of the sort keys, flat number by default. Ties are
+	// broken by flat ID, so the order is total.
+	SortBy string
+	Desc   bool
+
+	// After continues the listing past the flat a previous page ended with.
+	After *FlatCursor
+	Limit int
+}
+
+// FlatCursor is the position of a flat in a sorted listing.
+type FlatCursor struct {
+	Value int64
+	ID    int64
+}
+
+func IsValidFlatSort(sortBy string) bool {
+	switch sortBy {
+	case SortByFlatNumber, SortByPrice, SortByRooms:
+		return true
+	}
+	return false
+}
+
+// SortValue returns the value of the flat the query sorts by.
+func (q FlatQuery) SortValue(f Flat) int64 {
+	switch q.SortBy {
+	case SortByPrice:
+		return int64(f.Price)
+	case SortByRooms:
+		return int64(f.Rooms)
+	default:
+		return f.FlatNumber
+	}
+}
+
+// CursorOf returns the position of the flat in the listing.
+func (q FlatQuery) CursorOf(f Flat) FlatCursor {
+	return FlatCursor{Value: q.SortValue(f), ID: f.ID}
+}
+
+// Matches reports whether the flat belongs to the listing, ignoring the
+// page boundaries.
+func (q FlatQuery) Matches(f Flat) bool {
+	switch {
+	case q.Role != "" && !SeesAllFlats(q.Role) && f.Status != StatusApproved:
+	case q.Status != "" && f.Status != q.Status:
+	case q.MinPrice != 0 && f.Price < q.MinPrice:
+	case q.MaxPrice != 0 && f.Price > q.MaxPrice:
+	case q.Rooms != 0 && f.Rooms != q.Rooms:
+	case q.MinFlatNumber != 0 && f.FlatNumber < q.MinFlatNumber:
+	case q.MaxFlatNumber != 0 && f.FlatNumber > q.MaxFlatNumber:
+	default:
+		return true
+	}
+	return false
+}
+
+// FlatEdit changes the listing of a flat on behalf of Actor. Nil fields are
+// left as they are.
+type FlatEdit struct {
+	HouseNumber int64
+	FlatNumber  int64
+	Price       *int
+	Rooms       *int
+	Actor       string
+	Role        string
+	At          time.Time
+	// ExpectedVersion, if set, is the version the edit was based on.
+	ExpectedVersion int64
+}
+
+// FlatArchival withdraws a flat on behalf of Actor.
+type FlatArchival struct {
+	HouseNumber int64
+	FlatNumber  int64
+	Actor       string
+	Role        string
+	At          time.Time
+	// ExpectedVersion, if set, is the version the withdrawal was based on.
+	ExpectedVersion int64
+}
+
+// FlatPrice is a price a flat was listed at, from ChangedAt until the next
+// one.
+type FlatPrice struct {
+	FlatID    int64     `json:"-"`
+	Price     int       `json:"price"`
+	ChangedBy string    `json:"-"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ModerationDecision is an approval or a decline of a flat. The owner of a
+// declined flat learns from Reason and Comment what to fix before the flat
+// is resubmitted.
+type ModerationDecision struct {
+	FlatID    int64     `json:"-"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	Moderator string    `json:"-"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
+// IsDecision reports whether the status ends a review.
+func IsDecision(status string) bool {
+	return status == StatusApproved || status == StatusDeclined
+}
+
+// CheckFlatEdit reports whether the actor may edit or withdraw the flat in
+// its current state. Only the owner of the flat and moderators may, and not
+// while the flat is under review.
+func CheckFlatEdit(current Flat, actor, role string, expectedVersion int64) error {
+	if err := CheckVersion("flat", expectedVersion, current.Version); err != nil {
+		return err
+	}
+	if role != RoleModerator && current.Owner != actor {
+		return ErrNotFlatOwner
+	}
+	if current.Status == StatusOnModeration {
+		return ErrFlatOnModeration
+	}
+	return nil
+}
+
+// ResubmittedStatus returns the status of the flat after an edit by role: a
+// reviewed flat has to be reviewed again.
+func ResubmittedStatus(current, role string) (string, error) {
+	if current == StatusCreated {
+		return current, nil
+	}
+	if err := CheckTransitionRole(current, StatusCreated, role); err != nil {
+		return "", err
+	}
+	return StatusCreated, nil
+}
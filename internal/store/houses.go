@@ -0,0 +1,99 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// Keys house listings can be sorted by.
+const (
+	SortByCreatedAt       = "created_at"
+	SortByLastFlatAddedAt = "last_flat_added_at"
+)
+
+// HouseSummary is a house in the catalog with the number of flats clients
+// can see in it.
+type HouseSummary struct {
+	House
+	ApprovedFlats int64 `json:"approved_flats"`
+}
+
+// HouseUpdate edits the details of a house. Nil fields are left as they
+// are.
+type HouseUpdate struct {
+	HouseNumber int64
+	Address     *string
+	Developer   *string
+	YearBuilt   *int
+	At          time.Time
+	// ExpectedVersion, if set, is the version the update was based on.
+	ExpectedVersion int64
+}
+
+// Apply returns the house with the update applied.
+func (u HouseUpdate) Apply(h House) House {
+	if u.Address != nil {
+		h.Address = *u.Address
+	}
+	if u.Developer != nil {
+		h.Developer = *u.Developer
+	}
+	if u.YearBuilt != nil {
+		h.YearBuilt = *u.YearBuilt
+	}
+	return h
+}
+
+// HouseQuery selects a page of the house catalog. Zero fields don't filter.
+type HouseQuery struct {
+	// Address matches houses whose address contains it, ignoring case.
+	Address string
+	// Developer matches the developer name, ignoring case.
+	Developer        string
+	MinYearBuilt     int
+	MaxYearBuilt     int
+	HasApprovedFlats bool
+
+	// SortBy is one of the house sort keys, creation time by default. Ties
+	// are broken by house number.
+	SortBy string
+	Desc   bool
+
+	// After continues the listing past the house a previous page ended
+	// with.
+	After *HouseCursor
+	Limit int
+}
+
+// HouseCursor is the position of a house in a sorted listing.
+type HouseCursor struct {
+	Time        time.Time
+	HouseNumber int64
+}
+
+func IsValidHouseSort(sortBy string) bool {
+	return sortBy == SortByCreatedAt || sortBy == SortByLastFlatAddedAt
+}
+
+// CursorOf returns the position of the house in the listing.
+func (q HouseQuery) CursorOf(h House) HouseCursor {
+	if q.SortBy == SortByLastFlatAddedAt {
+		return HouseCursor{Time: h.LastFlatAddedAt, HouseNumber: h.HouseNumber}
+	}
+	return HouseCursor{Time: h.CreatedAt, HouseNumber: h.HouseNumber}
+}
+
+// Matches reports whether the house belongs to the listing, ignoring the
+// page boundaries.
+func (q HouseQuery) Matches(h HouseSummary) bool {
+	switch {
+	case q.Address != "" && !strings.Contains(strings.ToLower(h.Address), strings.ToLower(q.Address)):
+	case q.Developer != "" && !strings.EqualFold(h.Developer, q.Developer):
+	case q.MinYearBuilt != 0 && h.YearBuilt < q.MinYearBuilt:
+	case q.MaxYearBuilt != 0 && h.YearBuilt > q.MaxYearBuilt:
+	case q.HasApprovedFlats && h.ApprovedFlats == 0:
+	default:
+		return true
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"time"
 )
 
@@ -9,6 +10,9 @@ type User struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Type     string `json:"type"`
+	// DisabledAt is set while the account is disabled. Disabled users
+	// can't log in or refresh their tokens.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
 }
 
 type House struct {
@@ -18,6 +22,11 @@ type House struct {
 	Developer       string    `json:"developer,omitempty"`
 	CreatedAt       time.Time `json:"created_at,omitempty"`
 	LastFlatAddedAt time.Time `json:"last_flat_added_at,omitempty"`
+	// Version grows by one with every write of the house.
+	Version int64 `json:"version,omitempty"`
+	// DeletedAt is set once the house has been deleted. Deleted houses and
+	// their flats are kept but no longer returned.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type Flat struct {
@@ -28,22 +37,244 @@ type Flat struct {
 	Rooms       int    `json:"rooms"`
 	Status      string `json:"status"`
 	Moderator   string
+	// Owner is the subject of the account that created the flat.
+	Owner     string    `json:"-"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	// Version grows by one with every write of the flat.
+	Version int64 `json:"version,omitempty"`
+	// ArchivedAt is set once the flat has been withdrawn. Archived flats
+	// are kept but no longer returned.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// ApprovedPrice is the price the flat had when it was last approved, or
+	// zero if it never was.
+	ApprovedPrice int `json:"-"`
+
+	// The moderation lease: while the flat is on moderation only Moderator
+	// may finish the review, and only until the lease expires.
+	ModerationStartedAt *time.Time `json:"moderation_started_at,omitempty"`
+	LeaseExpiresAt      *time.Time `json:"lease_expires_at,omitempty"`
+}
+
+// FlatStatusChange is a status change of a flat requested by Actor. It is
+// checked against the current state of the flat while the flat is locked.
+type FlatStatusChange struct {
+	HouseNumber int64
+	FlatNumber  int64
+	Status      string
+	Actor       string
+	Role        string
+	At          time.Time
+	// ExpectedVersion, if set, is the version the change was based on.
+	ExpectedVersion int64
+
+	// Reason and Comment explain a decision. Declines have a reason from
+	// the catalogue, the comment is optional.
+	Reason  string
+	Comment string
+
+	// The moderation lease granted to Actor when Status is on moderation.
+	ModerationStartedAt *time.Time
+	LeaseExpiresAt      *time.Time
+}
+
+// Subscription asks for an email about every newly approved flat in a house.
+type Subscription struct {
+	ID          int64
+	Email       string    `json:"email"`
+	HouseNumber int64     `json:"house_number"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ModerationQueueFilter narrows the flats waiting for review. Zero fields
+// don't filter.
+type ModerationQueueFilter struct {
+	HouseNumber   int64
+	CreatedBefore time.Time
+	CreatedAfter  time.Time
+	Limit         int
+}
+
+// RefreshToken is a server-side record of an opaque refresh token. Only the
+// token hash is stored. Tokens rotated from the same login share a FamilyID.
+type RefreshToken struct {
+	ID        int64
+	TokenHash string
+	FamilyID  string
+	Subject   string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
 }
 
+// Logout ends the session of an access token. FamilyID, if set, is the
+// refresh token family of the session.
+type Logout struct {
+	Subject   string
+	TokenID   string
+	ExpiresAt time.Time
+	FamilyID  string
+	At        time.Time
+}
+
+// Database stores the service state. Writes of accounts, sessions, houses,
+// flats, subscriptions and webhooks are recorded in the audit log in the same
+// transaction, on behalf of the actor of ctx, see WithAudit.
 type Database interface {
-	CreateTable() error
+	// CreateUser stores the user and sets its ID. It is recorded as
+	// user.registered, see NewRegistrationAuditRecord.
+	CreateUser(ctx context.Context, user *User) error
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id int64) (*User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	// UpdateUserPassword replaces the password hash of the user with a new
+	// hash of the same password, recorded as user.password_rehashed.
+	UpdateUserPassword(ctx context.Context, id int64, password string) error
+	// SearchUsers returns up to query.Limit users matching the query, in
+	// id order.
+	SearchUsers(ctx context.Context, query UserQuery) ([]User, error)
+	// UpdateUser applies the update and returns the updated user. It fails
+	// with ErrUserNotFound for unknown users.
+	UpdateUser(ctx context.Context, update UserUpdate) (*User, error)
+
+	// CreateInvitation stores the invitation and sets its ID.
+	CreateInvitation(ctx context.Context, invitation *Invitation) error
+	// AcceptInvitation uses up the invitation with the token hash and
+	// creates the user with its role, if CheckInvitation allows it. The
+	// user is recorded as registered like by CreateUser.
+	AcceptInvitation(ctx context.Context, tokenHash string, user *User, at time.Time) error
+
+	// CreateHouse stores the house and sets its Version.
+	CreateHouse(ctx context.Context, house *House) error
+	GetHouseByID(ctx context.Context, id int64) (*House, error)
+	// ListHouses returns up to query.Limit houses of the catalog matching
+	// the query, in its order.
+	ListHouses(ctx context.Context, query HouseQuery) ([]HouseSummary, error)
+	// UpdateHouse applies the update and returns the updated house. It
+	// fails with ErrHouseNotFound for unknown and deleted houses.
+	UpdateHouse(ctx context.Context, update HouseUpdate) (*House, error)
+	// DeleteHouse hides the house and its flats. Nothing is removed from
+	// the database.
+	DeleteHouse(ctx context.Context, houseNumber, expectedVersion int64, at time.Time) error
+
+	// CreateFlat adds the flat, sets its ID and Version and updates
+	// LastFlatAddedAt of its house to the flat's CreatedAt. Flats can't be
+	// added to deleted houses. The price starts the flat's price history.
+	CreateFlat(ctx context.Context, flat *Flat) error
+	// EditFlat applies the edit if CheckFlatEdit allows it and returns the
+	// updated flat. A reviewed flat goes back to created. Price changes are
+	// added to the price history and recorded as flat.price_changed events.
+	EditFlat(ctx context.Context, edit FlatEdit) (*Flat, error)
+	// ArchiveFlat withdraws the flat if CheckFlatEdit allows it. Archived
+	// flats are treated as missing by every other method.
+	ArchiveFlat(ctx context.Context, archival FlatArchival) error
+	// ListFlatPrices returns the price history of the flat, oldest first.
+	ListFlatPrices(ctx context.Context, flatID int64) ([]FlatPrice, error)
+	// GetFlatsByHouseID returns up to query.Limit flats of the house
+	// matching the query, in its order.
+	GetFlatsByHouseID(ctx context.Context, houseID int64, query FlatQuery) ([]Flat, error)
+	// ChangeFlatStatus applies the change if CheckStatusChange allows it
+	// for the current state of the flat and returns the updated flat. The
+	// check and the update are atomic. Approvals and declines are added to
+	// the moderation history of the flat.
+	ChangeFlatStatus(ctx context.Context, change FlatStatusChange) (*Flat, error)
+	// ListModerationDecisions returns the moderation history of the flat,
+	// oldest first.
+	ListModerationDecisions(ctx context.Context, flatID int64) ([]ModerationDecision, error)
+	GetFlatStatus(ctx context.Context, houseID int64, flatNumber int64) (Flat, error)
+	GetFlat(ctx context.Context, houseNumber, flatNumber int64) (*Flat, error)
+
+	// ExtendFlatLease moves the lease expiry of a flat under review. It
+	// fails with ErrLeaseNotHeld unless the moderator holds a live lease.
+	// The version of the flat stays, so ETags held by others remain valid.
+	ExtendFlatLease(ctx context.Context, houseNumber, flatNumber int64, moderator string, expiresAt time.Time) error
+	// ReleaseFlatLease returns a flat under review to the queue.
+	ReleaseFlatLease(ctx context.Context, houseNumber, flatNumber int64) error
+	// ReleaseExpiredLeases returns flats whose lease expired before now to
+	// the queue and reports how many there were.
+	ReleaseExpiredLeases(ctx context.Context, now time.Time) (int64, error)
+
+	// ClaimNextFlat puts the oldest created flat matching filter on
+	// moderation for the moderator. Concurrent callers never get the same
+	// flat. It returns nil when there is nothing to review.
+	ClaimNextFlat(ctx context.Context, filter ModerationQueueFilter, moderator string, startedAt, leaseExpiresAt time.Time) (*Flat, error)
+	// ListModerationQueue returns created flats matching filter, oldest
+	// first.
+	ListModerationQueue(ctx context.Context, filter ModerationQueueFilter) ([]Flat, error)
+
+	// CreateSubscription subscribes the email to the house. Subscribing
+	// again is not an error. Subscribing and unsubscribing are audited.
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	DeleteSubscription(ctx context.Context, email string, houseNumber int64) error
+	GetHouseSubscribers(ctx context.Context, houseNumber int64) ([]string, error)
+
+	// ClaimOutboxEvents returns up to limit pending events due at now,
+	// oldest first, and hides them from other callers until claimUntil.
+	ClaimOutboxEvents(ctx context.Context, now, claimUntil time.Time, limit int) ([]Event, error)
+	MarkEventPublished(ctx context.Context, id int64, at time.Time) error
+	// MarkEventFailed records a failed delivery. The event is retried at
+	// nextAttemptAt, or never again when dead is set. deliveredTo replaces
+	// the event's DeliveredTo.
+	MarkEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time, dead bool, deliveredTo []string) error
+	// ListHouseEvents returns up to limit events of the house with ids
+	// above afterID, whatever their delivery state, in id order.
+	ListHouseEvents(ctx context.Context, houseNumber, afterID int64, limit int) ([]Event, error)
+	// ListLateHouseEvents returns the events of the house with ids below
+	// beforeID that were created at most window before event beforeID, in
+	// id order. Ids are taken at insert, so these events may have been
+	// committed after beforeID. It returns nothing if there is no event
+	// beforeID.
+	ListLateHouseEvents(ctx context.Context, houseNumber, beforeID int64, window time.Duration) ([]Event, error)
+
+	// CreateWebhook stores the webhook and sets its ID. Creating and
+	// deleting webhooks and replaying deliveries are audited.
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+	GetWebhook(ctx context.Context, id int64) (*Webhook, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+
+	// CreateWebhookDeliveries queues deliveries. A delivery of an event to
+	// a webhook that already has one is skipped.
+	CreateWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at
+	// now, oldest first, and hides them from other callers until
+	// claimUntil.
+	ClaimWebhookDeliveries(ctx context.Context, now, claimUntil time.Time, limit int) ([]WebhookDelivery, error)
+	// UpdateWebhookDelivery stores the outcome of a delivery attempt.
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error)
+	// ReplayWebhookDelivery queues the delivery again from scratch.
+	ReplayWebhookDelivery(ctx context.Context, webhookID, deliveryID int64, now time.Time) error
 
-	CreateUser(user *User) error
-	GetUserByEmail(email string) (*User, error)
+	// CreateRefreshToken starts a session of the subject with its first
+	// refresh token, recorded as user.logged_in.
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	// RotateRefreshToken marks the old token as used and stores its
+	// successor, recorded as user.token_refreshed. It fails with
+	// ErrRefreshTokenReused if the old token has already been used or
+	// revoked.
+	RotateRefreshToken(ctx context.Context, oldHash string, next *RefreshToken) error
+	// RevokeRefreshTokenFamily ends the session of a refresh token that was
+	// used again, recorded as user.token_reused.
+	RevokeRefreshTokenFamily(ctx context.Context, token RefreshToken) error
+	RevokeSubjectRefreshTokens(ctx context.Context, subject string) error
 
-	CreateHouse(house *House) error
-	GetHouseByID(id int64) (*House, error)
-	UpdateHouse(house *House) error
-	UpdateHouseFlatTime(time time.Time) error
+	// Logout revokes the tokens of the session, recorded as
+	// user.logged_out. The access token stays on the revocation list until
+	// it would have expired anyway.
+	Logout(ctx context.Context, logout Logout) error
+	// LogoutAll revokes every refresh token of the subject and every access
+	// token issued up to at, recorded as user.logged_out_all.
+	LogoutAll(ctx context.Context, subject string, at time.Time) error
+	// RevokeSubjectTokens revokes every access token of the subject issued
+	// up to the given time, to the microsecond.
+	RevokeSubjectTokens(ctx context.Context, subject string, issuedBefore time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, tokenID, subject string, issuedAt time.Time) (bool, error)
 
-	CreateFlat(flat *Flat) error
-	GetFlatsByHouseID(houseID int64, userType string) ([]Flat, error)
-	UpdateFlat(flat *Flat, token string) error
-	GetFlatStatus(houseID int64, flatNumber int64) (Flat, error)
-	GetFlat(houseNumber, flatNumber int64) (*Flat, error)
+	// CreateAuditRecord adds the record to the audit log and sets its ID.
+	CreateAuditRecord(ctx context.Context, record *AuditRecord) error
+	// ListAuditRecords returns up to filter.Limit records matching filter,
+	// newest first.
+	ListAuditRecords(ctx context.Context, filter AuditFilter) ([]AuditRecord, error)
 }
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"context"
+
+	"avtest/internal/store"
+)
+
+// Audit methods
+func (db *MemoryDB) CreateAuditRecord(ctx context.Context, record *store.AuditRecord) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	*record = db.addAuditRecord(*record)
+	return nil
+}
+
+func (db *MemoryDB) ListAuditRecords(ctx context.Context, filter store.AuditFilter) ([]store.AuditRecord, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var records []store.AuditRecord
+	for i := len(db.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+		r := db.audit[i]
+		if filter.BeforeID != 0 && r.ID >= filter.BeforeID {
+			continue
+		}
+		if filter.Matches(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
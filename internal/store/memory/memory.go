@@ -0,0 +1,569 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// MemoryDB is an in-memory implementation of store.Database. It mirrors the
+// constraints of the postgres schema, so it can replace a live database in
+// tests and local runs.
+type MemoryDB struct {
+	mu sync.RWMutex
+
+	users     map[string]store.User
+	houses    map[int64]store.House
+	flats     []store.Flat
+	prices    []store.FlatPrice
+	decisions []store.ModerationDecision
+
+	subscriptions []store.Subscription
+	outbox        []store.Event
+	audit         []store.AuditRecord
+	invitations   []store.Invitation
+
+	webhooks          []store.Webhook
+	webhookDeliveries []store.WebhookDelivery
+
+	refreshTokens      map[string]*store.RefreshToken
+	revokedTokens      map[string]time.Time
+	subjectRevocations map[string]time.Time
+
+	lastUserID         int64
+	lastFlatID         int64
+	lastSubscriptionID int64
+	lastEventID        int64
+	lastAuditID        int64
+	lastRefreshTokenID int64
+	lastInvitationID   int64
+
+	lastWebhookID         int64
+	lastWebhookDeliveryID int64
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		users:              make(map[string]store.User),
+		houses:             make(map[int64]store.House),
+		refreshTokens:      make(map[string]*store.RefreshToken),
+		revokedTokens:      make(map[string]time.Time),
+		subjectRevocations: make(map[string]time.Time),
+	}
+}
+
+// User methods
+func (db *MemoryDB) CreateUser(ctx context.Context, user *store.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.addUser(ctx, user, time.Now())
+}
+
+// addUser stores the user, sets its ID and records the registration. The
+// caller holds the write lock.
+func (db *MemoryDB) addUser(ctx context.Context, user *store.User, at time.Time) error {
+	if _, ok := db.users[user.Email]; ok {
+		return store.ErrUserExists
+	}
+
+	u := *user
+	u.ID = db.lastUserID + 1
+	record, err := store.NewRegistrationAuditRecord(ctx, u, at)
+	if err != nil {
+		return err
+	}
+
+	db.lastUserID = u.ID
+	db.users[u.Email] = u
+	db.addAuditRecord(record)
+	user.ID = u.ID
+	return nil
+}
+
+func (db *MemoryDB) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	u, ok := db.users[email]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (db *MemoryDB) GetUserByID(ctx context.Context, id int64) (*store.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, u := range db.users {
+		if u.ID == id {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *MemoryDB) ListUsers(ctx context.Context) ([]store.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var users []store.User
+	for _, u := range db.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+func (db *MemoryDB) UpdateUserPassword(ctx context.Context, id int64, password string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for email, u := range db.users {
+		if u.ID != id {
+			continue
+		}
+		record, err := store.NewAuditRecord(ctx, store.AuditUserPasswordRehashed, store.AuditEntityUser,
+			strconv.FormatInt(id, 10), nil, nil, time.Now())
+		if err != nil {
+			return err
+		}
+		u.Password = password
+		db.users[email] = u
+		db.addAuditRecord(record)
+	}
+	return nil
+}
+
+// House methods
+func (db *MemoryDB) CreateHouse(ctx context.Context, house *store.House) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.houses[house.HouseNumber]; ok {
+		return store.ErrHouseExists
+	}
+
+	h := *house
+	h.Version = 1
+	event, err := store.NewHouseEvent(store.EventHouseCreated, h, time.Now())
+	if err != nil {
+		return err
+	}
+	record, err := houseAuditRecord(ctx, store.AuditHouseCreated, nil, &h, h.CreatedAt)
+	if err != nil {
+		return err
+	}
+	db.houses[h.HouseNumber] = h
+	db.addEvent(event)
+	db.addAuditRecord(record)
+	house.Version = h.Version
+	return nil
+}
+
+func (db *MemoryDB) GetHouseByID(ctx context.Context, id int64) (*store.House, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	h, ok := db.houses[id]
+	if !ok || h.DeletedAt != nil {
+		return nil, nil
+	}
+	return &h, nil
+}
+
+func (db *MemoryDB) ListHouses(ctx context.Context, query store.HouseQuery) ([]store.HouseSummary, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	approved := make(map[int64]int64)
+	for _, f := range db.flats {
+		if f.Status == store.StatusApproved && f.ArchivedAt == nil {
+			approved[f.HouseNumber]++
+		}
+	}
+
+	var houses []store.HouseSummary
+	for _, h := range db.houses {
+		if h.DeletedAt != nil {
+			continue
+		}
+		summary := store.HouseSummary{House: h, ApprovedFlats: approved[h.HouseNumber]}
+		if !query.Matches(summary) {
+			continue
+		}
+		if query.After != nil && !houseCursorBefore(*query.After, query.CursorOf(h), query.Desc) {
+			continue
+		}
+		houses = append(houses, summary)
+	}
+
+	sort.Slice(houses, func(a, b int) bool {
+		return houseCursorBefore(query.CursorOf(houses[a].House), query.CursorOf(houses[b].House), query.Desc)
+	})
+	if query.Limit > 0 && len(houses) > query.Limit {
+		houses = houses[:query.Limit]
+	}
+	return houses, nil
+}
+
+// houseCursorBefore reports whether a comes before b in the listing order.
+func houseCursorBefore(a, b store.HouseCursor, desc bool) bool {
+	if !a.Time.Equal(b.Time) {
+		return a.Time.Before(b.Time) != desc
+	}
+	if a.HouseNumber != b.HouseNumber {
+		return (a.HouseNumber < b.HouseNumber) != desc
+	}
+	return false
+}
+
+func (db *MemoryDB) UpdateHouse(ctx context.Context, update store.HouseUpdate) (*store.House, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current, ok := db.houses[update.HouseNumber]
+	if !ok || current.DeletedAt != nil {
+		return nil, store.ErrHouseNotFound
+	}
+	if err := store.CheckVersion("house", update.ExpectedVersion, current.Version); err != nil {
+		return nil, err
+	}
+
+	h := update.Apply(current)
+	h.Version++
+	record, err := houseAuditRecord(ctx, store.AuditHouseUpdated, &current, &h, update.At)
+	if err != nil {
+		return nil, err
+	}
+
+	db.houses[h.HouseNumber] = h
+	db.addAuditRecord(record)
+	return &h, nil
+}
+
+func (db *MemoryDB) DeleteHouse(ctx context.Context, houseNumber, expectedVersion int64, at time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current, ok := db.houses[houseNumber]
+	if !ok || current.DeletedAt != nil {
+		return store.ErrHouseNotFound
+	}
+	if err := store.CheckVersion("house", expectedVersion, current.Version); err != nil {
+		return err
+	}
+
+	record, err := houseAuditRecord(ctx, store.AuditHouseDeleted, &current, nil, at)
+	if err != nil {
+		return err
+	}
+
+	h := current
+	h.DeletedAt = &at
+	h.Version++
+	db.houses[houseNumber] = h
+	db.addAuditRecord(record)
+	return nil
+}
+
+// houseAuditRecord returns a record of the house changing from before to
+// after.
+func houseAuditRecord(ctx context.Context, action string, before, after *store.House, at time.Time) (store.AuditRecord, error) {
+	h := after
+	if before != nil {
+		h = before
+	}
+	var b, a interface{}
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+	return store.NewAuditRecord(ctx, action, store.AuditEntityHouse, strconv.FormatInt(h.HouseNumber, 10), b, a, at)
+}
+
+// addAuditRecord appends to the audit log and returns the stored record.
+// The caller must hold the lock.
+func (db *MemoryDB) addAuditRecord(r store.AuditRecord) store.AuditRecord {
+	db.lastAuditID++
+	r.ID = db.lastAuditID
+	db.audit = append(db.audit, r)
+	return r
+}
+
+// houseLive reports whether the house exists and has not been deleted. The
+// caller must hold the lock.
+func (db *MemoryDB) houseLive(houseNumber int64) bool {
+	h, ok := db.houses[houseNumber]
+	return ok && h.DeletedAt == nil
+}
+
+// flatLive reports whether the flat has not been archived and its house has
+// not been deleted. The caller must hold the lock.
+func (db *MemoryDB) flatLive(f store.Flat) bool {
+	return f.ArchivedAt == nil && db.houseLive(f.HouseNumber)
+}
+
+// Flat methods
+func (db *MemoryDB) CreateFlat(ctx context.Context, flat *store.Flat) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	h, ok := db.houses[flat.HouseNumber]
+	if !ok || h.DeletedAt != nil {
+		return store.ErrHouseNotFound
+	}
+
+	f := *flat
+	f.ID = db.lastFlatID + 1
+	f.Moderator = ""
+	f.Version = 1
+	event, err := store.NewFlatEvent(store.EventFlatCreated, f, time.Now())
+	if err != nil {
+		return err
+	}
+	record, err := store.NewFlatAuditRecord(ctx, store.AuditFlatCreated, nil, &f, f.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	db.lastFlatID++
+	db.flats = append(db.flats, f)
+	db.prices = append(db.prices, store.FlatPrice{FlatID: f.ID, Price: f.Price, ChangedBy: f.Owner, ChangedAt: f.CreatedAt})
+	h.LastFlatAddedAt = f.CreatedAt
+	h.Version++
+	db.houses[h.HouseNumber] = h
+	db.addEvent(event)
+	db.addAuditRecord(record)
+	flat.ID, flat.Version = f.ID, f.Version
+	return nil
+}
+
+func (db *MemoryDB) GetFlat(ctx context.Context, houseNumber, flatNumber int64) (*store.Flat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if i := db.findFlat(houseNumber, flatNumber); i >= 0 {
+		f := db.flats[i]
+		f.Moderator = ""
+		return &f, nil
+	}
+	return nil, nil
+}
+
+func (db *MemoryDB) GetFlatsByHouseID(ctx context.Context, houseID int64, query store.FlatQuery) ([]store.Flat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if !db.houseLive(houseID) {
+		return nil, nil
+	}
+
+	var flats []store.Flat
+	for _, f := range db.flats {
+		if f.HouseNumber != houseID || f.ArchivedAt != nil || !query.Matches(f) {
+			continue
+		}
+		if query.After != nil && !cursorBefore(*query.After, query.CursorOf(f), query.Desc) {
+			continue
+		}
+		f.Moderator = ""
+		f.ModerationStartedAt = nil
+		f.LeaseExpiresAt = nil
+		flats = append(flats, f)
+	}
+
+	sort.Slice(flats, func(a, b int) bool {
+		return cursorBefore(query.CursorOf(flats[a]), query.CursorOf(flats[b]), query.Desc)
+	})
+	if query.Limit > 0 && len(flats) > query.Limit {
+		flats = flats[:query.Limit]
+	}
+	return flats, nil
+}
+
+// cursorBefore reports whether a comes before b in the listing order.
+func cursorBefore(a, b store.FlatCursor, desc bool) bool {
+	if a.Value != b.Value {
+		return (a.Value < b.Value) != desc
+	}
+	if a.ID != b.ID {
+		return (a.ID < b.ID) != desc
+	}
+	return false
+}
+
+func (db *MemoryDB) GetFlatStatus(ctx context.Context, houseID int64, flatNumber int64) (store.Flat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if i := db.findFlat(houseID, flatNumber); i >= 0 {
+		return db.flats[i], nil
+	}
+	return store.Flat{}, store.ErrFlatNotFound
+}
+
+// ChangeFlatStatus checks and applies the change under the write lock.
+func (db *MemoryDB) ChangeFlatStatus(ctx context.Context, change store.FlatStatusChange) (*store.Flat, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findFlat(change.HouseNumber, change.FlatNumber)
+	if i < 0 {
+		return nil, store.ErrFlatNotFound
+	}
+	if err := store.CheckStatusChange(db.flats[i], change); err != nil {
+		return nil, err
+	}
+
+	current := db.flats[i]
+	f := current
+	f.Status = change.Status
+	f.Moderator = change.Actor
+	f.ModerationStartedAt = change.ModerationStartedAt
+	f.LeaseExpiresAt = change.LeaseExpiresAt
+	f.Version++
+	if f.Status == store.StatusApproved {
+		f.ApprovedPrice = f.Price
+	}
+	event, err := store.NewFlatStatusEvent(f, current, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	record, err := store.NewFlatAuditRecord(ctx, store.AuditFlatStatusChanged, &current, &f, change.At)
+	if err != nil {
+		return nil, err
+	}
+
+	db.flats[i] = f
+	db.addEvent(event)
+	db.addAuditRecord(record)
+	if store.IsDecision(f.Status) {
+		db.decisions = append(db.decisions, store.ModerationDecision{FlatID: f.ID, Status: f.Status,
+			Reason: change.Reason, Comment: change.Comment, Moderator: change.Actor, DecidedAt: change.At})
+	}
+	f.Moderator = ""
+	return &f, nil
+}
+
+// EditFlat checks and applies the edit under the write lock.
+func (db *MemoryDB) EditFlat(ctx context.Context, edit store.FlatEdit) (*store.Flat, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findFlat(edit.HouseNumber, edit.FlatNumber)
+	if i < 0 {
+		return nil, store.ErrFlatNotFound
+	}
+	current := db.flats[i]
+	if err := store.CheckFlatEdit(current, edit.Actor, edit.Role, edit.ExpectedVersion); err != nil {
+		return nil, err
+	}
+	status, err := store.ResubmittedStatus(current.Status, edit.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	f := current
+	if edit.Price != nil {
+		f.Price = *edit.Price
+	}
+	if edit.Rooms != nil {
+		f.Rooms = *edit.Rooms
+	}
+	f.Status = status
+	f.Moderator = ""
+	f.Version++
+	event, err := store.NewFlatEvent(store.EventFlatUpdated, f, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	record, err := store.NewFlatAuditRecord(ctx, store.AuditFlatUpdated, &current, &f, edit.At)
+	if err != nil {
+		return nil, err
+	}
+
+	var priceEvent *store.Event
+	if f.Price != current.Price {
+		e, err := store.NewFlatPriceEvent(f, current, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		priceEvent = &e
+	}
+
+	db.flats[i] = f
+	db.addEvent(event)
+	if priceEvent != nil {
+		db.prices = append(db.prices, store.FlatPrice{FlatID: f.ID, Price: f.Price, ChangedBy: edit.Actor, ChangedAt: edit.At})
+		db.addEvent(*priceEvent)
+	}
+	db.addAuditRecord(record)
+	return &f, nil
+}
+
+func (db *MemoryDB) ListFlatPrices(ctx context.Context, flatID int64) ([]store.FlatPrice, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var prices []store.FlatPrice
+	for _, p := range db.prices {
+		if p.FlatID == flatID {
+			prices = append(prices, p)
+		}
+	}
+	return prices, nil
+}
+
+// ArchiveFlat checks and archives the flat under the write lock.
+func (db *MemoryDB) ArchiveFlat(ctx context.Context, archival store.FlatArchival) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findFlat(archival.HouseNumber, archival.FlatNumber)
+	if i < 0 {
+		return store.ErrFlatNotFound
+	}
+	current := db.flats[i]
+	if err := store.CheckFlatEdit(current, archival.Actor, archival.Role, archival.ExpectedVersion); err != nil {
+		return err
+	}
+
+	f := current
+	f.ArchivedAt = &archival.At
+	f.Version++
+	event, err := store.NewFlatEvent(store.EventFlatArchived, f, time.Now())
+	if err != nil {
+		return err
+	}
+	record, err := store.NewFlatAuditRecord(ctx, store.AuditFlatArchived, &current, nil, archival.At)
+	if err != nil {
+		return err
+	}
+
+	db.flats[i] = f
+	db.addEvent(event)
+	db.addAuditRecord(record)
+	return nil
+}
+
+// findFlat returns the index of the flat, or -1 when there is no such flat,
+// it has been archived or its house has been deleted. The caller must hold
+// the lock.
+func (db *MemoryDB) findFlat(houseNumber, flatNumber int64) int {
+	for i, f := range db.flats {
+		if f.HouseNumber == houseNumber && f.FlatNumber == flatNumber && db.flatLive(f) {
+			return i
+		}
+	}
+	return -1
+}
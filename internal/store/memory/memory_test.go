@@ -0,0 +1,525 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDB_Constraints(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	err := db.CreateUser(ctx, &store.User{Email: "user@mail.ru", Password: "pass", Type: "client"})
+	require.NoError(t, err)
+	err = db.CreateUser(ctx, &store.User{Email: "user@mail.ru", Password: "pass", Type: "client"})
+	require.ErrorIs(t, err, store.ErrUserExists)
+
+	u, err := db.GetUserByEmail(ctx, "user@mail.ru")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), u.ID)
+
+	u, err = db.GetUserByEmail(ctx, "unknown@mail.ru")
+	require.NoError(t, err)
+	require.Nil(t, u)
+
+	err = db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000})
+	require.NoError(t, err)
+	err = db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000})
+	require.ErrorIs(t, err, store.ErrHouseExists)
+
+	err = db.CreateFlat(ctx, &store.Flat{HouseNumber: 2, FlatNumber: 1, Status: "created"})
+	require.ErrorIs(t, err, store.ErrHouseNotFound)
+
+	_, err = db.GetFlatStatus(ctx, 1, 1)
+	require.ErrorIs(t, err, store.ErrFlatNotFound)
+}
+
+func TestMemoryDB_HouseUpdateAndDelete(t *testing.T) {
+	ctx := store.WithAudit(context.Background(), store.AuditInfo{Actor: "moderator", Role: store.RoleModerator})
+	db := NewMemoryDB()
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+
+	address := "new address"
+	h, err := db.UpdateHouse(ctx, store.HouseUpdate{HouseNumber: 1, Address: &address, ExpectedVersion: 2})
+	require.NoError(t, err)
+	require.Equal(t, "new address", h.Address)
+	require.EqualValues(t, 3, h.Version)
+
+	_, err = db.UpdateHouse(ctx, store.HouseUpdate{HouseNumber: 1, Address: &address, ExpectedVersion: 2})
+	require.ErrorIs(t, err, store.ErrVersionConflict)
+	_, err = db.UpdateHouse(ctx, store.HouseUpdate{HouseNumber: 2, Address: &address})
+	require.ErrorIs(t, err, store.ErrHouseNotFound)
+
+	at := time.Now()
+	require.NoError(t, db.DeleteHouse(ctx, 1, 3, at))
+	require.ErrorIs(t, db.DeleteHouse(ctx, 1, 0, at), store.ErrHouseNotFound)
+
+	// The flats are kept but can't be seen or changed.
+	require.Len(t, db.flats, 1)
+	_, err = db.GetFlatStatus(ctx, 1, 1)
+	require.ErrorIs(t, err, store.ErrFlatNotFound)
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusOnModeration,
+		Actor: "moderator", Role: store.RoleModerator})
+	require.ErrorIs(t, err, store.ErrFlatNotFound)
+	err = db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusCreated})
+	require.ErrorIs(t, err, store.ErrHouseNotFound)
+
+	// The house and the flat were created before the update.
+	require.Len(t, db.audit, 4)
+	require.Equal(t, store.AuditHouseUpdated, db.audit[2].Action)
+	require.JSONEq(t, `"address"`, string(mustField(t, db.audit[2].Before, "address")))
+	require.JSONEq(t, `"new address"`, string(mustField(t, db.audit[2].After, "address")))
+	require.Equal(t, store.AuditHouseDeleted, db.audit[3].Action)
+	require.Equal(t, "1", db.audit[3].EntityID)
+	require.Equal(t, "moderator", db.audit[3].Actor)
+	require.Equal(t, store.RoleModerator, db.audit[3].Role)
+	require.Nil(t, db.audit[3].After)
+}
+
+func TestMemoryDB_EditAndArchiveFlat(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Price: 100, Rooms: 1,
+		Status: store.StatusCreated, Owner: "1"}))
+
+	price, rooms := 90, 2
+	_, err := db.EditFlat(ctx, store.FlatEdit{HouseNumber: 1, FlatNumber: 1, Price: &price, Actor: "2", Role: store.RoleClient})
+	require.ErrorIs(t, err, store.ErrNotFlatOwner)
+
+	f, err := db.EditFlat(ctx, store.FlatEdit{HouseNumber: 1, FlatNumber: 1, Price: &price, Actor: "1", Role: store.RoleClient})
+	require.NoError(t, err)
+	require.Equal(t, 90, f.Price)
+	_, err = db.EditFlat(ctx, store.FlatEdit{HouseNumber: 1, FlatNumber: 1, Rooms: &rooms, Actor: "1", Role: store.RoleClient})
+	require.NoError(t, err)
+
+	// Only the initial price and the change are in the history.
+	require.Equal(t, []int{100, 90}, []int{db.prices[0].Price, db.prices[1].Price})
+	require.Len(t, db.prices, 2)
+
+	require.NoError(t, db.ArchiveFlat(ctx, store.FlatArchival{HouseNumber: 1, FlatNumber: 1, Actor: "1", Role: store.RoleClient}))
+	f, err = db.GetFlat(ctx, 1, 1)
+	require.NoError(t, err)
+	require.Nil(t, f)
+	require.ErrorIs(t, db.ArchiveFlat(ctx, store.FlatArchival{HouseNumber: 1, FlatNumber: 1, Actor: "1"}), store.ErrFlatNotFound)
+
+	require.Len(t, db.audit, 5)
+	require.Equal(t, store.AuditFlatArchived, db.audit[4].Action)
+	require.Equal(t, "1/1", db.audit[4].EntityID)
+}
+
+func TestMemoryDB_ModerateRecreatedFlat(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	now := time.Now()
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated, Owner: "1"}))
+	require.NoError(t, db.ArchiveFlat(ctx, store.FlatArchival{HouseNumber: 1, FlatNumber: 1, Actor: "1", Role: store.RoleClient}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated, Owner: "1"}))
+
+	// Only the live flat changes, the archived one is left as it was.
+	archived := db.flats[0]
+	expires := now.Add(time.Minute)
+	f, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusOnModeration,
+		Actor: "2", Role: store.RoleModerator, At: now, ModerationStartedAt: &now, LeaseExpiresAt: &expires})
+	require.NoError(t, err)
+	require.Equal(t, db.flats[1].ID, f.ID)
+	require.NoError(t, db.ReleaseFlatLease(ctx, 1, 1))
+
+	require.Equal(t, archived, db.flats[0])
+	require.Equal(t, store.StatusCreated, db.flats[1].Status)
+	require.Equal(t, int64(3), db.flats[1].Version)
+}
+
+func TestMemoryDB_ListAuditRecords(t *testing.T) {
+	db := NewMemoryDB()
+
+	ctx := store.WithAudit(context.Background(), store.AuditInfo{Actor: "1", Role: store.RoleModerator, RequestID: "req-1"})
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 2, Address: "address", YearBuilt: 2000}))
+	ctx = store.WithAudit(context.Background(), store.AuditInfo{Actor: "2", Role: store.RoleClient, RequestID: "req-2"})
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+
+	records, err := db.ListAuditRecords(ctx, store.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, store.AuditFlatCreated, records[0].Action)
+	require.Equal(t, "req-2", records[0].RequestID)
+
+	records, err = db.ListAuditRecords(ctx, store.AuditFilter{Actor: "1", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "2", records[0].EntityID)
+
+	records, err = db.ListAuditRecords(ctx, store.AuditFilter{Actor: "1", BeforeID: records[0].ID})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "1", records[0].EntityID)
+
+	records, err = db.ListAuditRecords(ctx, store.AuditFilter{Entity: store.AuditEntityFlat, RequestID: "req-1"})
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
+
+func TestMemoryDB_AcceptInvitation(t *testing.T) {
+	db := NewMemoryDB()
+	ctx := context.Background()
+	now := time.Now()
+
+	inv := &store.Invitation{TokenHash: "hash", Email: "moderator@mail.ru", Role: store.RoleModerator,
+		CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, db.CreateInvitation(ctx, inv))
+
+	user := &store.User{Email: "other@mail.ru", Type: store.RoleClient}
+	require.ErrorIs(t, db.AcceptInvitation(ctx, "hash", user, now), store.ErrInvitationInvalid)
+	user.Email = "moderator@mail.ru"
+	require.ErrorIs(t, db.AcceptInvitation(ctx, "hash", user, now.Add(time.Hour)), store.ErrInvitationInvalid)
+	require.NoError(t, db.AcceptInvitation(ctx, "hash", user, now))
+	require.Equal(t, store.RoleModerator, user.Type)
+	require.ErrorIs(t, db.AcceptInvitation(ctx, "hash", &store.User{Email: "moderator@mail.ru"}, now), store.ErrInvitationInvalid)
+
+	disabled := true
+	u, err := db.UpdateUser(ctx, store.UserUpdate{ID: user.ID, Disabled: &disabled, At: now})
+	require.NoError(t, err)
+	require.NotNil(t, u.DisabledAt)
+	users, err := db.SearchUsers(ctx, store.UserQuery{Email: "MODERATOR", Disabled: &disabled})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	_, err = db.UpdateUser(ctx, store.UserUpdate{ID: 99, Disabled: &disabled, At: now})
+	require.ErrorIs(t, err, store.ErrUserNotFound)
+}
+
+func TestMemoryDB_AuditAccountsAndWebhooks(t *testing.T) {
+	db := NewMemoryDB()
+	now := time.Now()
+
+	// Users registering themselves are their own actors.
+	ctx := store.WithAudit(context.Background(), store.AuditInfo{RequestID: "req-1"})
+	user := &store.User{Email: "client@mail.ru", Password: "hash", Type: store.RoleClient}
+	require.NoError(t, db.CreateUser(ctx, user))
+	records, err := db.ListAuditRecords(ctx, store.AuditFilter{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, store.AuditUserRegistered, records[0].Action)
+	require.Equal(t, "1", records[0].Actor)
+	require.Equal(t, store.RoleClient, records[0].Role)
+	require.NotContains(t, string(records[0].After), "hash")
+
+	ctx = store.WithAudit(context.Background(), store.AuditInfo{Actor: "1", Role: store.RoleClient})
+	require.NoError(t, db.Logout(ctx, store.Logout{Subject: "1", TokenID: "jti", ExpiresAt: now.Add(time.Hour), At: now}))
+	revoked, err := db.IsAccessTokenRevoked(ctx, "jti", "1", now)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	// Secrets stay out of the log.
+	webhook := &store.Webhook{URL: "https://example.com", Secret: "secret", EventTypes: []string{store.EventFlatApproved}, CreatedAt: now}
+	require.NoError(t, db.CreateWebhook(ctx, webhook))
+	require.NoError(t, db.DeleteWebhook(ctx, webhook.ID))
+	require.ErrorIs(t, db.DeleteWebhook(ctx, webhook.ID), store.ErrWebhookNotFound)
+
+	records, err = db.ListAuditRecords(ctx, store.AuditFilter{Actor: "1"})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, store.AuditWebhookDeleted, records[0].Action)
+	require.Equal(t, store.AuditWebhookCreated, records[1].Action)
+	require.Equal(t, store.AuditUserLoggedOut, records[2].Action)
+	for _, r := range records[:2] {
+		require.NotContains(t, string(r.Before)+string(r.After), "secret")
+	}
+}
+
+// mustField returns a field of a JSON object.
+func mustField(t *testing.T, doc json.RawMessage, name string) json.RawMessage {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(doc, &fields))
+	return fields[name]
+}
+
+func TestMemoryDB_GetFlatsByHouseID(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: "created"}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: "created"}))
+
+	_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 2, Status: "approved", Actor: "token", Role: store.RoleModerator})
+	require.ErrorIs(t, err, store.ErrIllegalTransition)
+
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 2, Status: "on moderation", Actor: "token", Role: store.RoleModerator})
+	require.NoError(t, err)
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 2, Status: "approved", Actor: "token", Role: store.RoleModerator})
+	require.NoError(t, err)
+
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 3, Status: "approved", Actor: "token", Role: store.RoleModerator})
+	require.ErrorIs(t, err, store.ErrFlatNotFound)
+
+	f, err := db.GetFlatStatus(ctx, 1, 2)
+	require.NoError(t, err)
+	require.Equal(t, "token", f.Moderator)
+
+	flats, err := db.GetFlatsByHouseID(ctx, 1, store.FlatQuery{Role: store.RoleModerator})
+	require.NoError(t, err)
+	require.Len(t, flats, 2)
+
+	flats, err = db.GetFlatsByHouseID(ctx, 1, store.FlatQuery{Role: store.RoleClient})
+	require.NoError(t, err)
+	require.Len(t, flats, 1)
+	require.Equal(t, int64(2), flats[0].FlatNumber)
+}
+
+func TestMemoryDB_GetFlatsByHouseIDPages(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	prices := []int{300, 100, 200, 100, 500, 400}
+	for i, price := range prices {
+		require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: int64(i + 1), Price: price, Rooms: i%2 + 1, Status: store.StatusCreated}))
+	}
+
+	// Pages of two, by price descending, are stable on equal prices.
+	query := store.FlatQuery{Role: store.RoleModerator, SortBy: store.SortByPrice, Desc: true, Limit: 2}
+	var got []int64
+	for {
+		page, err := db.GetFlatsByHouseID(ctx, 1, query)
+		require.NoError(t, err)
+		for _, f := range page {
+			got = append(got, f.FlatNumber)
+		}
+		if len(page) < query.Limit {
+			break
+		}
+		cursor := query.CursorOf(page[len(page)-1])
+		query.After = &cursor
+	}
+	require.Equal(t, []int64{5, 6, 1, 3, 4, 2}, got)
+
+	flats, err := db.GetFlatsByHouseID(ctx, 1, store.FlatQuery{MinPrice: 150, MaxPrice: 400, Rooms: 1})
+	require.NoError(t, err)
+	require.Len(t, flats, 2)
+	require.Equal(t, int64(1), flats[0].FlatNumber)
+	require.Equal(t, int64(3), flats[1].FlatNumber)
+
+	flats, err = db.GetFlatsByHouseID(ctx, 1, store.FlatQuery{MinFlatNumber: 2, MaxFlatNumber: 4, Status: store.StatusApproved})
+	require.NoError(t, err)
+	require.Empty(t, flats)
+}
+
+func TestMemoryDB_ReleaseExpiredLeases(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	now := time.Now()
+	for house := int64(1); house <= 2; house++ {
+		require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: house, Address: "address", YearBuilt: 2000}))
+		require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: house, FlatNumber: 1, Status: store.StatusCreated}))
+		f, err := db.ClaimNextFlat(ctx, store.ModerationQueueFilter{HouseNumber: house}, "moderator", now, now.Add(time.Minute))
+		require.NoError(t, err)
+		require.NotNil(t, f)
+	}
+	require.NoError(t, db.DeleteHouse(ctx, 2, 0, now))
+	events := len(db.outbox)
+
+	// Leases on flats of deleted houses are left alone.
+	n, err := db.ReleaseExpiredLeases(ctx, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	require.Len(t, db.outbox, events+1)
+	require.Equal(t, int64(1), db.outbox[len(db.outbox)-1].HouseNumber)
+}
+
+func TestMemoryDB_LeaseAudit(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	now := time.Now()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+
+	// Claims and releases record the flat before and after them.
+	_, err := db.ClaimNextFlat(ctx, store.ModerationQueueFilter{}, "moderator", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	claimed := db.audit[len(db.audit)-1]
+	require.Equal(t, store.AuditFlatStatusChanged, claimed.Action)
+	require.JSONEq(t, `"created"`, string(mustField(t, claimed.Before, "status")))
+	require.JSONEq(t, `"on moderation"`, string(mustField(t, claimed.After, "status")))
+	require.Nil(t, mustField(t, claimed.Before, "moderator"))
+
+	// A heartbeat is not a change of the flat: no record and no new version.
+	records := len(db.audit)
+	require.NoError(t, db.ExtendFlatLease(ctx, 1, 1, "moderator", now.Add(time.Hour)))
+	require.Len(t, db.audit, records)
+	f, err := db.GetFlat(ctx, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), f.Version)
+
+	n, err := db.ReleaseExpiredLeases(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	released := db.audit[len(db.audit)-1]
+	require.JSONEq(t, `"on moderation"`, string(mustField(t, released.Before, "status")))
+	require.JSONEq(t, `"created"`, string(mustField(t, released.After, "status")))
+}
+
+func TestMemoryDB_ClaimNextFlat(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+
+	start := time.Now()
+	const total = 20
+	for i := 1; i <= total; i++ {
+		err := db.CreateFlat(ctx, &store.Flat{
+			HouseNumber: 1,
+			FlatNumber:  int64(i),
+			Status:      store.StatusCreated,
+			CreatedAt:   start.Add(-time.Duration(i) * time.Minute),
+		})
+		require.NoError(t, err)
+	}
+
+	queue, err := db.ListModerationQueue(ctx, store.ModerationQueueFilter{Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, queue, 3)
+	require.Equal(t, int64(total), queue[0].FlatNumber)
+
+	var (
+		mu      sync.Mutex
+		claimed = make(map[int64]string)
+		wg      sync.WaitGroup
+	)
+	for m := 0; m < 4; m++ {
+		moderator := string(rune('a' + m))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				f, err := db.ClaimNextFlat(ctx, store.ModerationQueueFilter{}, moderator, start, start.Add(time.Hour))
+				if err != nil || f == nil {
+					return
+				}
+				mu.Lock()
+				if prev, ok := claimed[f.FlatNumber]; ok {
+					t.Errorf("flat %d claimed by %s and %s", f.FlatNumber, prev, moderator)
+				}
+				claimed[f.FlatNumber] = moderator
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, claimed, total)
+
+	queue, err = db.ListModerationQueue(ctx, store.ModerationQueueFilter{})
+	require.NoError(t, err)
+	require.Empty(t, queue)
+}
+
+func TestMemoryDB_Outbox(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 2, Address: "address", YearBuilt: 2000}))
+
+	added := time.Now()
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated, CreatedAt: added}))
+	_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusOnModeration, Actor: "moderator", Role: store.RoleModerator})
+	require.NoError(t, err)
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusApproved, Actor: "moderator", Role: store.RoleModerator})
+	require.NoError(t, err)
+
+	// A rejected change records no event.
+	_, err = db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: store.StatusOnModeration, Actor: "moderator", Role: store.RoleModerator})
+	require.ErrorIs(t, err, store.ErrIllegalTransition)
+
+	h, err := db.GetHouseByID(ctx, 1)
+	require.NoError(t, err)
+	require.True(t, h.LastFlatAddedAt.Equal(added))
+	h, err = db.GetHouseByID(ctx, 2)
+	require.NoError(t, err)
+	require.True(t, h.LastFlatAddedAt.IsZero())
+
+	now := time.Now()
+	events, err := db.ClaimOutboxEvents(ctx, now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []string{
+		store.EventHouseCreated,
+		store.EventHouseCreated,
+		store.EventFlatCreated,
+		store.EventFlatStatusChanged,
+		store.EventFlatApproved,
+	}, types)
+
+	// Claimed events are hidden until the claim runs out.
+	events, err = db.ClaimOutboxEvents(ctx, now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestMemoryDB_ListLateHouseEvents(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 2, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Status: store.StatusCreated}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 2, Status: store.StatusCreated}))
+	// The house was created long before the flats.
+	db.outbox[0].CreatedAt = db.outbox[0].CreatedAt.Add(-time.Hour)
+
+	events, err := db.ListLateHouseEvents(ctx, 1, 4, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, int64(3), events[0].ID)
+
+	events, err = db.ListLateHouseEvents(ctx, 1, 99, time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestMemoryDB_ApprovalCarriesPreviousApprovedPrice(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryDB()
+	require.NoError(t, db.CreateHouse(ctx, &store.House{HouseNumber: 1, Address: "address", YearBuilt: 2000}))
+	require.NoError(t, db.CreateFlat(ctx, &store.Flat{HouseNumber: 1, FlatNumber: 1, Price: 1000, Rooms: 1,
+		Status: store.StatusCreated, Owner: "1"}))
+	approve := func() store.FlatApproval {
+		t.Helper()
+		for _, status := range []string{store.StatusOnModeration, store.StatusApproved} {
+			_, err := db.ChangeFlatStatus(ctx, store.FlatStatusChange{HouseNumber: 1, FlatNumber: 1, Status: status,
+				Actor: "moderator", Role: store.RoleModerator})
+			require.NoError(t, err)
+		}
+		e := db.outbox[len(db.outbox)-1]
+		require.Equal(t, store.EventFlatApproved, e.Type)
+		var approval store.FlatApproval
+		require.NoError(t, json.Unmarshal(e.Payload, &approval))
+		return approval
+	}
+
+	require.Zero(t, approve().PreviousApprovedPrice)
+
+	// Two edits on the way to the next approval: the drop is measured from
+	// the price subscribers last saw.
+	for _, price := range []int{900, 800} {
+		_, err := db.EditFlat(ctx, store.FlatEdit{HouseNumber: 1, FlatNumber: 1, Price: &price, Actor: "1", Role: store.RoleClient})
+		require.NoError(t, err)
+	}
+	approval := approve()
+	require.Equal(t, 1000, approval.PreviousApprovedPrice)
+	require.Equal(t, 800, approval.Price)
+}
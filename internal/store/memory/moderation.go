@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Moderation lease methods
+// ExtendFlatLease only moves the expiry. A lease is not a change of the
+// flat, so it neither bumps the version nor writes an audit record.
+func (db *MemoryDB) ExtendFlatLease(ctx context.Context, houseNumber, flatNumber int64, moderator string, expiresAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findFlat(houseNumber, flatNumber)
+	if i < 0 {
+		return store.ErrLeaseNotHeld
+	}
+
+	f := &db.flats[i]
+	if f.Status != store.StatusOnModeration || f.Moderator != moderator ||
+		f.LeaseExpiresAt == nil || !f.LeaseExpiresAt.After(time.Now()) {
+		return store.ErrLeaseNotHeld
+	}
+	f.LeaseExpiresAt = &expiresAt
+	return nil
+}
+
+func (db *MemoryDB) ReleaseFlatLease(ctx context.Context, houseNumber, flatNumber int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := db.findFlat(houseNumber, flatNumber)
+	if i < 0 {
+		return store.ErrFlatNotFound
+	}
+	if err := store.CheckTransitionRole(db.flats[i].Status, store.StatusCreated, store.RoleSystem); err != nil {
+		return err
+	}
+
+	return db.releaseLease(ctx, i, time.Now())
+}
+
+func (db *MemoryDB) ReleaseExpiredLeases(ctx context.Context, now time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var n int64
+	for i, f := range db.flats {
+		if f.Status == store.StatusOnModeration && f.LeaseExpiresAt != nil && !f.LeaseExpiresAt.After(now) && db.flatLive(f) {
+			if err := db.releaseLease(ctx, i, now); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Moderation queue methods
+func (db *MemoryDB) ClaimNextFlat(ctx context.Context, filter store.ModerationQueueFilter, moderator string, startedAt, leaseExpiresAt time.Time) (*store.Flat, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	queue := db.moderationQueue(filter)
+	if len(queue) == 0 {
+		return nil, nil
+	}
+
+	current := db.flats[queue[0]]
+	f := current
+	f.Status = store.StatusOnModeration
+	f.Moderator = moderator
+	f.ModerationStartedAt = &startedAt
+	f.LeaseExpiresAt = &leaseExpiresAt
+	f.Version++
+	event, err := store.NewFlatEvent(store.EventFlatStatusChanged, f, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	record, err := store.NewFlatAuditRecord(ctx, store.AuditFlatStatusChanged, &current, &f, startedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	db.flats[queue[0]] = f
+	db.addEvent(event)
+	db.addAuditRecord(record)
+	f.Moderator = ""
+	return &f, nil
+}
+
+func (db *MemoryDB) ListModerationQueue(ctx context.Context, filter store.ModerationQueueFilter) ([]store.Flat, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var flats []store.Flat
+	for _, i := range db.moderationQueue(filter) {
+		if filter.Limit > 0 && len(flats) == filter.Limit {
+			break
+		}
+		f := db.flats[i]
+		f.Moderator = ""
+		flats = append(flats, f)
+	}
+	return flats, nil
+}
+
+// moderationQueue returns the indexes of flats waiting for review, oldest
+// first. The caller must hold the lock.
+func (db *MemoryDB) moderationQueue(filter store.ModerationQueueFilter) []int {
+	var queue []int
+	for i, f := range db.flats {
+		switch {
+		case f.Status != store.StatusCreated:
+		case !db.flatLive(f):
+		case filter.HouseNumber != 0 && f.HouseNumber != filter.HouseNumber:
+		case !filter.CreatedBefore.IsZero() && f.CreatedAt.After(filter.CreatedBefore):
+		case !filter.CreatedAfter.IsZero() && f.CreatedAt.Before(filter.CreatedAfter):
+		default:
+			queue = append(queue, i)
+		}
+	}
+
+	sort.SliceStable(queue, func(a, b int) bool {
+		fa, fb := db.flats[queue[a]], db.flats[queue[b]]
+		if !fa.CreatedAt.Equal(fb.CreatedAt) {
+			return fa.CreatedAt.Before(fb.CreatedAt)
+		}
+		return fa.ID < fb.ID
+	})
+	return queue
+}
+
+// releaseLease returns the flat at index i to the queue. The caller must
+// hold the lock.
+func (db *MemoryDB) releaseLease(ctx context.Context, i int, at time.Time) error {
+	current := db.flats[i]
+	f := current
+	f.Status = store.StatusCreated
+	f.Moderator = ""
+	f.ModerationStartedAt = nil
+	f.LeaseExpiresAt = nil
+	f.Version++
+	event, err := store.NewFlatEvent(store.EventFlatStatusChanged, f, time.Now())
+	if err != nil {
+		return err
+	}
+	record, err := store.NewFlatAuditRecord(ctx, store.AuditFlatStatusChanged, &current, &f, at)
+	if err != nil {
+		return err
+	}
+
+	db.flats[i] = f
+	db.addEvent(event)
+	db.addAuditRecord(record)
+	return nil
+}
+
+// Moderation history methods
+func (db *MemoryDB) ListModerationDecisions(ctx context.Context, flatID int64) ([]store.ModerationDecision, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var decisions []store.ModerationDecision
+	for _, d := range db.decisions {
+		if d.FlatID == flatID {
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions, nil
+}
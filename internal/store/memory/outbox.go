@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// addEvent records the event in the outbox. The caller must hold the lock,
+// so the event is added together with the change that caused it.
+func (db *MemoryDB) addEvent(e store.Event) {
+	db.lastEventID++
+	e.ID = db.lastEventID
+	db.outbox = append(db.outbox, e)
+}
+
+// Outbox methods
+func (db *MemoryDB) ClaimOutboxEvents(ctx context.Context, now, claimUntil time.Time, limit int) ([]store.Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var events []store.Event
+	for i := range db.outbox {
+		if len(events) == limit {
+			break
+		}
+		e := &db.outbox[i]
+		if e.Status != store.EventPending || e.NextAttemptAt.After(now) {
+			continue
+		}
+		e.NextAttemptAt = claimUntil
+		events = append(events, *e)
+	}
+	return events, nil
+}
+
+func (db *MemoryDB) MarkEventPublished(ctx context.Context, id int64, at time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if e := db.findEvent(id); e != nil {
+		e.Status = store.EventPublished
+		e.Attempts++
+		e.PublishedAt = &at
+		e.LastError = ""
+	}
+	return nil
+}
+
+func (db *MemoryDB) MarkEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time, dead bool, deliveredTo []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if e := db.findEvent(id); e != nil {
+		e.Status = store.EventPending
+		if dead {
+			e.Status = store.EventDead
+		}
+		e.Attempts++
+		e.NextAttemptAt = nextAttemptAt
+		e.LastError = lastError
+		e.DeliveredTo = slices.Clone(deliveredTo)
+	}
+	return nil
+}
+
+func (db *MemoryDB) ListHouseEvents(ctx context.Context, houseNumber, afterID int64, limit int) ([]store.Event, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var events []store.Event
+	for _, e := range db.outbox {
+		if len(events) == limit {
+			break
+		}
+		if e.HouseNumber == houseNumber && e.ID > afterID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (db *MemoryDB) ListLateHouseEvents(ctx context.Context, houseNumber, beforeID int64, window time.Duration) ([]store.Event, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	before := db.findEvent(beforeID)
+	if before == nil {
+		return nil, nil
+	}
+	since := before.CreatedAt.Add(-window)
+
+	var events []store.Event
+	for _, e := range db.outbox {
+		if e.HouseNumber == houseNumber && e.ID < beforeID && !e.CreatedAt.Before(since) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// findEvent returns the outbox event with the id or nil. The caller must
+// hold the lock.
+func (db *MemoryDB) findEvent(id int64) *store.Event {
+	for i := range db.outbox {
+		if db.outbox[i].ID == id {
+			return &db.outbox[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"avtest/internal/store"
+	"context"
+	"strconv"
+	"time"
+)
+
+// Subscription methods
+func (db *MemoryDB) CreateSubscription(ctx context.Context, sub *store.Subscription) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.houses[sub.HouseNumber]; !ok {
+		return store.ErrHouseNotFound
+	}
+	record, err := store.NewAuditRecord(ctx, store.AuditSubscriptionCreated, store.AuditEntitySubscription,
+		strconv.FormatInt(sub.HouseNumber, 10), nil, sub, sub.CreatedAt)
+	if err != nil {
+		return err
+	}
+	db.addAuditRecord(record)
+	for _, s := range db.subscriptions {
+		if s.HouseNumber == sub.HouseNumber && s.Email == sub.Email {
+			return nil
+		}
+	}
+
+	db.lastSubscriptionID++
+	s := *sub
+	s.ID = db.lastSubscriptionID
+	db.subscriptions = append(db.subscriptions, s)
+	return nil
+}
+
+func (db *MemoryDB) DeleteSubscription(ctx context.Context, email string, houseNumber int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, s := range db.subscriptions {
+		if s.HouseNumber == houseNumber && s.Email == email {
+			record, err := store.NewAuditRecord(ctx, store.AuditSubscriptionDeleted, store.AuditEntitySubscription,
+				strconv.FormatInt(houseNumber, 10), s, nil, time.Now())
+			if err != nil {
+				return err
+			}
+			db.subscriptions = append(db.subscriptions[:i], db.subscriptions[i+1:]...)
+			db.addAuditRecord(record)
+			return nil
+		}
+	}
+	return store.ErrSubscriptionNotFound
+}
+
+func (db *MemoryDB) GetHouseSubscribers(ctx context.Context, houseNumber int64) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var emails []string
+	for _, s := range db.subscriptions {
+		if s.HouseNumber == houseNumber {
+			emails = append(emails, s.Email)
+		}
+	}
+	return emails, nil
+}
@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Refresh token methods
+func (db *MemoryDB) CreateRefreshToken(ctx context.Context, token *store.RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	record, err := store.NewAuditRecord(ctx, store.AuditUserLoggedIn, store.AuditEntityUser, token.Subject,
+		nil, nil, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	db.lastRefreshTokenID++
+	t := *token
+	t.ID = db.lastRefreshTokenID
+	db.refreshTokens[t.TokenHash] = &t
+	db.addAuditRecord(record)
+	return nil
+}
+
+func (db *MemoryDB) GetRefreshToken(ctx context.Context, tokenHash string) (*store.RefreshToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t, ok := db.refreshTokens[tokenHash]
+	if !ok {
+		return nil, nil
+	}
+	res := *t
+	return &res, nil
+}
+
+func (db *MemoryDB) RotateRefreshToken(ctx context.Context, oldHash string, next *store.RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, ok := db.refreshTokens[oldHash]
+	if !ok || old.UsedAt != nil || old.RevokedAt != nil {
+		return store.ErrRefreshTokenReused
+	}
+	record, err := store.NewAuditRecord(ctx, store.AuditUserTokenRefreshed, store.AuditEntityUser, next.Subject,
+		nil, nil, next.CreatedAt)
+	if err != nil {
+		return err
+	}
+	usedAt := next.CreatedAt
+	old.UsedAt = &usedAt
+
+	db.lastRefreshTokenID++
+	t := *next
+	t.ID = db.lastRefreshTokenID
+	db.refreshTokens[t.TokenHash] = &t
+	db.addAuditRecord(record)
+	return nil
+}
+
+func (db *MemoryDB) RevokeRefreshTokenFamily(ctx context.Context, token store.RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now := time.Now()
+	record, err := store.NewAuditRecord(ctx, store.AuditUserTokenReused, store.AuditEntityUser, token.Subject,
+		nil, map[string]string{"family_id": token.FamilyID}, now)
+	if err != nil {
+		return err
+	}
+	db.revokeRefreshTokens(func(t *store.RefreshToken) bool { return t.FamilyID == token.FamilyID }, now)
+	db.addAuditRecord(record)
+	return nil
+}
+
+func (db *MemoryDB) RevokeSubjectRefreshTokens(ctx context.Context, subject string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.revokeRefreshTokens(func(t *store.RefreshToken) bool { return t.Subject == subject }, time.Now())
+	return nil
+}
+
+// revokeRefreshTokens revokes the live refresh tokens that match. The caller
+// holds the write lock.
+func (db *MemoryDB) revokeRefreshTokens(match func(*store.RefreshToken) bool, at time.Time) {
+	for _, t := range db.refreshTokens {
+		if match(t) && t.RevokedAt == nil {
+			revokedAt := at
+			t.RevokedAt = &revokedAt
+		}
+	}
+}
+
+// Access token revocation methods
+func (db *MemoryDB) Logout(ctx context.Context, logout store.Logout) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	record, err := store.NewAuditRecord(ctx, store.AuditUserLoggedOut, store.AuditEntityUser, logout.Subject,
+		nil, nil, logout.At)
+	if err != nil {
+		return err
+	}
+
+	if logout.FamilyID != "" {
+		db.revokeRefreshTokens(func(t *store.RefreshToken) bool { return t.FamilyID == logout.FamilyID }, logout.At)
+	}
+	for id, exp := range db.revokedTokens {
+		if exp.Before(logout.At) {
+			delete(db.revokedTokens, id)
+		}
+	}
+	db.revokedTokens[logout.TokenID] = logout.ExpiresAt
+	db.addAuditRecord(record)
+	return nil
+}
+
+func (db *MemoryDB) LogoutAll(ctx context.Context, subject string, at time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	record, err := store.NewAuditRecord(ctx, store.AuditUserLoggedOutAll, store.AuditEntityUser, subject,
+		nil, nil, at)
+	if err != nil {
+		return err
+	}
+
+	db.revokeRefreshTokens(func(t *store.RefreshToken) bool { return t.Subject == subject }, at)
+	db.revokeSubjectTokens(subject, at)
+	db.addAuditRecord(record)
+	return nil
+}
+
+func (db *MemoryDB) RevokeSubjectTokens(ctx context.Context, subject string, issuedBefore time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.revokeSubjectTokens(subject, issuedBefore)
+	return nil
+}
+
+// revokeSubjectTokens revokes the access tokens of the subject issued up to
+// issuedBefore. The caller holds the write lock.
+func (db *MemoryDB) revokeSubjectTokens(subject string, issuedBefore time.Time) {
+	issuedBefore = issuedBefore.Truncate(time.Microsecond)
+	if cur, ok := db.subjectRevocations[subject]; !ok || cur.Before(issuedBefore) {
+		db.subjectRevocations[subject] = issuedBefore
+	}
+}
+
+func (db *MemoryDB) IsAccessTokenRevoked(ctx context.Context, tokenID, subject string, issuedAt time.Time) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok := db.revokedTokens[tokenID]; ok {
+		return true, nil
+	}
+	before, ok := db.subjectRevocations[subject]
+	return ok && !before.Before(issuedAt), nil
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// User administration methods
+func (db *MemoryDB) SearchUsers(ctx context.Context, query store.UserQuery) ([]store.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var users []store.User
+	for _, u := range db.users {
+		if u.ID > query.AfterID && query.Matches(u) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	if query.Limit > 0 && len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+	return users, nil
+}
+
+func (db *MemoryDB) UpdateUser(ctx context.Context, update store.UserUpdate) (*store.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for email, current := range db.users {
+		if current.ID != update.ID {
+			continue
+		}
+
+		u := update.Apply(current)
+		record, err := store.NewUserAuditRecord(ctx, update.AuditAction(), current, u, update.At)
+		if err != nil {
+			return nil, err
+		}
+		db.users[email] = u
+		db.addAuditRecord(record)
+		return &u, nil
+	}
+	return nil, store.ErrUserNotFound
+}
+
+// Invitation methods
+func (db *MemoryDB) CreateInvitation(ctx context.Context, inv *store.Invitation) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.lastInvitationID++
+	i := *inv
+	i.ID = db.lastInvitationID
+	record, err := store.NewAuditRecord(ctx, store.AuditInvitationCreated, store.AuditEntityInvitation,
+		strconv.FormatInt(i.ID, 10), nil, i, i.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	db.invitations = append(db.invitations, i)
+	db.addAuditRecord(record)
+	inv.ID = i.ID
+	return nil
+}
+
+func (db *MemoryDB) AcceptInvitation(ctx context.Context, tokenHash string, user *store.User, at time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, inv := range db.invitations {
+		if inv.TokenHash != tokenHash {
+			continue
+		}
+		if err := store.CheckInvitation(inv, user.Email, at); err != nil {
+			return err
+		}
+
+		user.Type = inv.Role
+		if err := db.addUser(ctx, user, at); err != nil {
+			return err
+		}
+		accepted := at
+		db.invitations[i].AcceptedAt = &accepted
+		return nil
+	}
+	return store.ErrInvitationInvalid
+}
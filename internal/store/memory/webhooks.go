@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Webhook methods
+func (db *MemoryDB) CreateWebhook(ctx context.Context, webhook *store.Webhook) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	w := *webhook
+	w.ID = db.lastWebhookID + 1
+	w.EventTypes = slices.Clone(webhook.EventTypes)
+	record, err := store.NewWebhookAuditRecord(ctx, store.AuditWebhookCreated, nil, &w, w.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	db.lastWebhookID = w.ID
+	db.webhooks = append(db.webhooks, w)
+	db.addAuditRecord(record)
+	webhook.ID = w.ID
+	return nil
+}
+
+func (db *MemoryDB) GetWebhook(ctx context.Context, id int64) (*store.Webhook, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, w := range db.webhooks {
+		if w.ID == id {
+			w.EventTypes = slices.Clone(w.EventTypes)
+			return &w, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *MemoryDB) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var webhooks []store.Webhook
+	for _, w := range db.webhooks {
+		w.EventTypes = slices.Clone(w.EventTypes)
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+func (db *MemoryDB) DeleteWebhook(ctx context.Context, id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := slices.IndexFunc(db.webhooks, func(w store.Webhook) bool { return w.ID == id })
+	if i < 0 {
+		return store.ErrWebhookNotFound
+	}
+	record, err := store.NewWebhookAuditRecord(ctx, store.AuditWebhookDeleted, &db.webhooks[i], nil, time.Now())
+	if err != nil {
+		return err
+	}
+	db.addAuditRecord(record)
+	db.webhooks = slices.Delete(db.webhooks, i, i+1)
+	db.webhookDeliveries = slices.DeleteFunc(db.webhookDeliveries, func(d store.WebhookDelivery) bool {
+		return d.WebhookID == id
+	})
+	return nil
+}
+
+// Webhook delivery methods
+func (db *MemoryDB) CreateWebhookDeliveries(ctx context.Context, deliveries []store.WebhookDelivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, d := range deliveries {
+		exists := slices.ContainsFunc(db.webhookDeliveries, func(cur store.WebhookDelivery) bool {
+			return cur.WebhookID == d.WebhookID && cur.EventID == d.EventID
+		})
+		if exists {
+			continue
+		}
+		db.lastWebhookDeliveryID++
+		d.ID = db.lastWebhookDeliveryID
+		db.webhookDeliveries = append(db.webhookDeliveries, d)
+	}
+	return nil
+}
+
+func (db *MemoryDB) ClaimWebhookDeliveries(ctx context.Context, now, claimUntil time.Time, limit int) ([]store.WebhookDelivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var deliveries []store.WebhookDelivery
+	for i := range db.webhookDeliveries {
+		if len(deliveries) == limit {
+			break
+		}
+		d := &db.webhookDeliveries[i]
+		if d.Status != store.DeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		d.NextAttemptAt = claimUntil
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, nil
+}
+
+func (db *MemoryDB) UpdateWebhookDelivery(ctx context.Context, delivery *store.WebhookDelivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, d := range db.webhookDeliveries {
+		if d.ID == delivery.ID {
+			db.webhookDeliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]store.WebhookDelivery, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var deliveries []store.WebhookDelivery
+	for i := len(db.webhookDeliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := db.webhookDeliveries[i]; d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (db *MemoryDB) ReplayWebhookDelivery(ctx context.Context, webhookID, deliveryID int64, now time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := range db.webhookDeliveries {
+		d := &db.webhookDeliveries[i]
+		if d.ID != deliveryID || d.WebhookID != webhookID {
+			continue
+		}
+		record, err := store.NewAuditRecord(ctx, store.AuditWebhookDeliveryReplayed, store.AuditEntityWebhook,
+			strconv.FormatInt(webhookID, 10), nil, map[string]int64{"delivery_id": deliveryID}, now)
+		if err != nil {
+			return err
+		}
+		db.addAuditRecord(record)
+		d.Status = store.DeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = now
+		d.ResponseCode = 0
+		d.LastError = ""
+		d.DeliveredAt = nil
+		return nil
+	}
+	return store.ErrWebhookDeliveryNotFound
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+)
+
+const auditColumns = `id, actor, role, action, entity, entity_id, before, after, request_id, created_at`
+
+// rowQueryer is a *sql.DB or a *sql.Tx.
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertAuditRecord writes the record and sets its ID. Written as part of a
+// tx, the audit log holds exactly the changes that were committed.
+func insertAuditRecord(ctx context.Context, q rowQueryer, r *store.AuditRecord) error {
+	return q.QueryRowContext(ctx, `
+		INSERT INTO audit_events (actor, role, action, entity, entity_id, before, after, request_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		r.Actor, r.Role, r.Action, r.Entity, r.EntityID, nullJSON(r.Before), nullJSON(r.After), r.RequestID,
+		r.CreatedAt.UTC(),
+	).Scan(&r.ID)
+}
+
+// insertHouseAudit records the change of a house from before to after as
+// part of tx.
+func insertHouseAudit(ctx context.Context, tx *sql.Tx, action string, before, after *store.House, at time.Time) error {
+	h := after
+	if before != nil {
+		h = before
+	}
+	var b, a interface{}
+	if before != nil {
+		b = before
+	}
+	if after != nil {
+		a = after
+	}
+	record, err := store.NewAuditRecord(ctx, action, store.AuditEntityHouse, strconv.FormatInt(h.HouseNumber, 10), b, a, at)
+	if err != nil {
+		return err
+	}
+	return insertAuditRecord(ctx, tx, &record)
+}
+
+// insertFlatAudit records the change of a flat from before to after as part
+// of tx.
+func insertFlatAudit(ctx context.Context, tx *sql.Tx, action string, before, after *store.Flat, at time.Time) error {
+	record, err := store.NewFlatAuditRecord(ctx, action, before, after, at)
+	if err != nil {
+		return err
+	}
+	return insertAuditRecord(ctx, tx, &record)
+}
+
+// nullJSON passes an empty document as NULL.
+func nullJSON(doc []byte) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
+
+// Audit methods
+func (db *PostgresDB) CreateAuditRecord(ctx context.Context, record *store.AuditRecord) error {
+	return insertAuditRecord(ctx, db.DB, record)
+}
+
+func (db *PostgresDB) ListAuditRecords(ctx context.Context, filter store.AuditFilter) ([]store.AuditRecord, error) {
+	var args []interface{}
+	add := func(cond string, arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf(cond, len(args))
+	}
+
+	conds := []string{"TRUE"}
+	if filter.Actor != "" {
+		conds = append(conds, add("actor = $%d", filter.Actor))
+	}
+	if filter.Action != "" {
+		conds = append(conds, add("action = $%d", filter.Action))
+	}
+	if filter.Entity != "" {
+		conds = append(conds, add("entity = $%d", filter.Entity))
+	}
+	if filter.EntityID != "" {
+		conds = append(conds, add("entity_id = $%d", filter.EntityID))
+	}
+	if filter.RequestID != "" {
+		conds = append(conds, add("request_id = $%d", filter.RequestID))
+	}
+	if !filter.From.IsZero() {
+		conds = append(conds, add("created_at >= $%d", filter.From.UTC()))
+	}
+	if !filter.To.IsZero() {
+		conds = append(conds, add("created_at < $%d", filter.To.UTC()))
+	}
+	if filter.BeforeID != 0 {
+		conds = append(conds, add("id < $%d", filter.BeforeID))
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_events
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += add(" LIMIT $%d", filter.Limit)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []store.AuditRecord
+	for rows.Next() {
+		var r store.AuditRecord
+		var before, after []byte
+		if err := rows.Scan(&r.ID, &r.Actor, &r.Role, &r.Action, &r.Entity, &r.EntityID, &before, &after,
+			&r.RequestID, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Before, r.After = before, after
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// EventsChannel is the channel outbox events are announced on.
+const EventsChannel = "avtest_events"
+
+const (
+	// maxNotificationPayload keeps notifications under the 8000 byte limit
+	// of NOTIFY. Bigger events are announced without their payload.
+	maxNotificationPayload = 7000
+
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// notificationPayload encodes the event for NOTIFY.
+func notificationPayload(e store.Event) (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxNotificationPayload {
+		e.Payload = nil
+		if data, err = json.Marshal(e); err != nil {
+			return "", err
+		}
+	}
+	return string(data), nil
+}
+
+// EventListener delivers outbox events committed by any replica to handle,
+// as soon as they are committed. Delivery is best effort: events committed
+// while the connection is down are not replayed, consumers that can't miss
+// events must read the outbox.
+type EventListener struct {
+	logger *zap.Logger
+	db     *PostgresDB
+	dsn    string
+	handle func(store.Event)
+}
+
+func NewEventListener(logger *zap.Logger, db *PostgresDB, dsn string, handle func(store.Event)) *EventListener {
+	return &EventListener{
+		logger: logger,
+		db:     db,
+		dsn:    dsn,
+		handle: handle,
+	}
+}
+
+// Run listens until the context is cancelled. The connection is
+// re-established automatically when it drops.
+func (l *EventListener) Run(ctx context.Context) error {
+	listener := pq.NewListener(l.dsn, minReconnectInterval, maxReconnectInterval,
+		func(ev pq.ListenerEventType, err error) {
+			switch ev {
+			case pq.ListenerEventDisconnected:
+				l.logger.Warn("event listener disconnected", zap.Error(err))
+			case pq.ListenerEventReconnected:
+				l.logger.Info("event listener reconnected")
+			case pq.ListenerEventConnectionAttemptFailed:
+				l.logger.Warn("event listener failed to connect", zap.Error(err))
+			}
+		})
+	defer listener.Close()
+
+	if err := listener.Listen(EventsChannel); err != nil {
+		return fmt.Errorf("listen %s: %w", EventsChannel, err)
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnect.
+			if n != nil {
+				l.dispatch(ctx, n.Extra)
+			}
+		case <-ping.C:
+			// Detects a dead connection that would otherwise go unnoticed
+			// while nothing is being announced.
+			go listener.Ping()
+		}
+	}
+}
+
+func (l *EventListener) dispatch(ctx context.Context, payload string) {
+	var e store.Event
+	if err := json.Unmarshal([]byte(payload), &e); err != nil {
+		l.logger.Error("failed to decode event notification", zap.Error(err))
+		return
+	}
+
+	// The payload was left out of the notification, load it from the outbox.
+	if len(e.Payload) == 0 || string(e.Payload) == "null" {
+		events, err := l.db.ListHouseEvents(ctx, e.HouseNumber, e.ID-1, 1)
+		if err != nil || len(events) == 0 || events[0].ID != e.ID {
+			l.logger.Error("failed to load announced event", zap.Int64("id", e.ID), zap.Error(err))
+			return
+		}
+		e = events[0]
+	}
+
+	l.handle(e)
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationPayload(t *testing.T) {
+	e, err := store.NewFlatEvent(store.EventFlatApproved, store.Flat{ID: 1, HouseNumber: 2, FlatNumber: 3}, time.Now())
+	require.NoError(t, err)
+	e.ID = 10
+
+	payload, err := notificationPayload(e)
+	require.NoError(t, err)
+	var decoded store.Event
+	require.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	require.Equal(t, e.ID, decoded.ID)
+	require.Equal(t, e.Type, decoded.Type)
+	require.Equal(t, e.HouseNumber, decoded.HouseNumber)
+	require.JSONEq(t, string(e.Payload), string(decoded.Payload))
+
+	// Events too big for NOTIFY are announced without the payload.
+	e, err = store.NewHouseEvent(store.EventHouseCreated, store.House{HouseNumber: 2, Address: strings.Repeat("a", 8000)}, time.Now())
+	require.NoError(t, err)
+	payload, err = notificationPayload(e)
+	require.NoError(t, err)
+	require.Less(t, len(payload), maxNotificationPayload)
+	decoded = store.Event{}
+	require.NoError(t, json.Unmarshal([]byte(payload), &decoded))
+	require.Equal(t, "null", string(decoded.Payload))
+}
@@ -0,0 +1,331 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockID is the key of the advisory lock that serialises migrations
+// started by several replicas at once.
+const migrationLockID = 7261535
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaAhead        = errors.New("database schema is newer than the application")
+	ErrUnknownMigration   = errors.New("unknown migration version")
+	errMalformedMigration = errors.New("malformed migration file name")
+)
+
+// Migration is a single schema change. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes the state of a migration in the database.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("%w: %s", errMalformedMigration, base)
+		}
+
+		versionStr, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errMalformedMigration, base)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errMalformedMigration, base)
+		}
+
+		body, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: migration %d has no up script", errMalformedMigration, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// LatestVersion returns the schema version the application expects.
+func LatestVersion() (int64, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// SchemaVersion returns the latest applied migration version, or 0 for an
+// empty database.
+func (db *PostgresDB) SchemaVersion() (int64, error) {
+	if err := ensureMigrationsTable(context.Background(), db.DB); err != nil {
+		return 0, err
+	}
+
+	var version int64
+	err := db.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// CheckSchema fails with ErrSchemaAhead when the database has migrations the
+// application doesn't know about.
+func (db *PostgresDB) CheckSchema() error {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, application supports up to %d",
+			ErrSchemaAhead, current, latest)
+	}
+	return nil
+}
+
+// MigrationStatus lists all known migrations with the time they were applied.
+func (db *PostgresDB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(context.Background(), db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		s := MigrationStatus{Migration: m}
+		if at, ok := applied[m.Version]; ok {
+			s.AppliedAt = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies all pending migrations.
+func (db *PostgresDB) MigrateUp() error {
+	latest, err := LatestVersion()
+	if err != nil {
+		return err
+	}
+	return db.MigrateTo(latest)
+}
+
+// MigrateDown reverts the given number of most recently applied migrations.
+func (db *PostgresDB) MigrateDown(steps int) error {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	target := current
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		if migrations[i].Version > current {
+			continue
+		}
+		target = 0
+		if i > 0 {
+			target = migrations[i-1].Version
+		}
+		steps--
+	}
+	return db.MigrateTo(target)
+}
+
+// MigrateTo moves the schema up or down to the given version. Every migration
+// runs in its own transaction together with the version bookkeeping.
+func (db *PostgresDB) MigrateTo(version int64) error {
+	ctx := context.Background()
+
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if version != 0 && !containsVersion(migrations, version) {
+		return fmt.Errorf("%w: %d", ErrUnknownMigration, version)
+	}
+
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for v := range applied {
+		if !containsVersion(migrations, v) {
+			return fmt.Errorf("%w: database has unknown migration %d", ErrSchemaAhead, v)
+		}
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok || m.Version > version {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m.Up,
+			`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok || m.Version <= version {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %d_%s is irreversible", m.Version, m.Name)
+		}
+		if err := applyMigration(ctx, conn, m.Down,
+			`DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func ensureMigrationsTable(ctx context.Context, q execQueryer) error {
+	_, err := q.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT now()
+		)`)
+	return err
+}
+
+func appliedMigrations(ctx context.Context, q execQueryer) (map[int64]time.Time, error) {
+	if err := ensureMigrationsTable(ctx, q); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, script, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func containsVersion(migrations []Migration, version int64) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		require.NotEmpty(t, m.Name)
+		require.NotEmpty(t, m.Up, "migration %d has no up script", m.Version)
+		require.NotEmpty(t, m.Down, "migration %d has no down script", m.Version)
+		if i > 0 {
+			require.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+
+	latest, err := LatestVersion()
+	require.NoError(t, err)
+	require.Equal(t, migrations[len(migrations)-1].Version, latest)
+}
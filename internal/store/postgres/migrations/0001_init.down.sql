@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS flats;
+DROP TABLE IF EXISTS houses;
+DROP TABLE IF EXISTS users;
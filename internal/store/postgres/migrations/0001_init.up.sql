@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	password TEXT NOT NULL,
+	type TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS houses (
+	id SERIAL PRIMARY KEY,
+	house_number INTEGER UNIQUE NOT NULL,
+	address TEXT NOT NULL,
+	year_built INTEGER NOT NULL,
+	developer TEXT,
+	created_at TIMESTAMP NOT NULL,
+	last_flat_added_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS flats (
+	id SERIAL PRIMARY KEY,
+	house_id INTEGER REFERENCES houses(house_number) ON DELETE CASCADE,
+	flat_number INTEGER NOT NULL,
+	price INTEGER NOT NULL,
+	rooms INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	moderator TEXT DEFAULT '' NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Raw tokens can't be restored; nothing to do.
+SELECT 1;
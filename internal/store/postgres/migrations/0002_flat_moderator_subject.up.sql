@@ -0,0 +1,7 @@
+-- flats.moderator used to hold the moderator's raw JWT. It now holds the
+-- token subject, so reviews started with an old token can never be finished:
+-- return those flats to the queue.
+UPDATE flats SET status = 'created', moderator = ''
+WHERE status = 'on moderation' AND moderator LIKE '%.%.%';
+
+UPDATE flats SET moderator = '' WHERE moderator LIKE '%.%.%';
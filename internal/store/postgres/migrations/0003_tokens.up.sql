@@ -0,0 +1,23 @@
+CREATE TABLE refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	token_hash TEXT UNIQUE NOT NULL,
+	family_id TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_subject_idx ON refresh_tokens (subject);
+
+CREATE TABLE revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE subject_revocations (
+	subject TEXT PRIMARY KEY,
+	revoked_before TIMESTAMP NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS flats_lease_expires_at_idx;
+
+ALTER TABLE flats
+	DROP COLUMN lease_expires_at,
+	DROP COLUMN moderation_started_at;
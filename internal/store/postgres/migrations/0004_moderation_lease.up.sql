@@ -0,0 +1,11 @@
+ALTER TABLE flats
+	ADD COLUMN moderation_started_at TIMESTAMP,
+	ADD COLUMN lease_expires_at TIMESTAMP;
+
+-- Reviews started before leases existed get one full default lease.
+UPDATE flats SET moderation_started_at = now() AT TIME ZONE 'UTC',
+	lease_expires_at = now() AT TIME ZONE 'UTC' + INTERVAL '30 minutes'
+WHERE status = 'on moderation';
+
+CREATE INDEX flats_lease_expires_at_idx ON flats (lease_expires_at)
+WHERE status = 'on moderation';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS flats_moderation_queue_idx;
+
+ALTER TABLE flats DROP COLUMN created_at;
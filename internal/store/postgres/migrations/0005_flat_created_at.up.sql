@@ -0,0 +1,5 @@
+ALTER TABLE flats ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT (now() AT TIME ZONE 'UTC');
+
+-- The queue is served oldest first.
+CREATE INDEX flats_moderation_queue_idx ON flats (created_at, id)
+WHERE status = 'created';
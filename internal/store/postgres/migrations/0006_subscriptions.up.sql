@@ -0,0 +1,7 @@
+CREATE TABLE subscriptions (
+	id SERIAL PRIMARY KEY,
+	email TEXT NOT NULL,
+	house_id INTEGER NOT NULL REFERENCES houses(house_number) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL,
+	UNIQUE (house_id, email)
+);
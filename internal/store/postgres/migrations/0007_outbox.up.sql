@@ -0,0 +1,15 @@
+CREATE TABLE outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_type TEXT NOT NULL,
+	house_id INTEGER NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	published_at TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at, id)
+WHERE status = 'pending';
@@ -0,0 +1,28 @@
+CREATE TABLE webhooks (
+	id SERIAL PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	event_types TEXT[] NOT NULL,
+	created_by TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id BIGINT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMP NOT NULL,
+	response_code INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	delivered_at TIMESTAMP,
+	-- The outbox may hand the same event over more than once.
+	UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at, id)
+WHERE status = 'pending';
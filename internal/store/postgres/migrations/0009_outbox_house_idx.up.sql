@@ -0,0 +1,2 @@
+-- Live feeds resume from the outbox by house.
+CREATE INDEX outbox_house_id_idx ON outbox (house_id, id);
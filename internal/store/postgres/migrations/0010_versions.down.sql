@@ -0,0 +1,2 @@
+ALTER TABLE houses DROP COLUMN version;
+ALTER TABLE flats DROP COLUMN version;
@@ -0,0 +1,2 @@
+ALTER TABLE flats ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE houses ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
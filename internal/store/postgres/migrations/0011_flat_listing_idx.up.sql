@@ -0,0 +1,4 @@
+-- Flat listings of a house are paged by (sort key, id).
+CREATE INDEX flats_house_flat_number_idx ON flats (house_id, flat_number, id);
+CREATE INDEX flats_house_price_idx ON flats (house_id, price, id);
+CREATE INDEX flats_house_rooms_idx ON flats (house_id, rooms, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS flats_house_approved_idx;
+DROP INDEX IF EXISTS houses_last_flat_added_at_idx;
+DROP INDEX IF EXISTS houses_created_at_idx;
+DROP INDEX IF EXISTS houses_address_trgm_idx;
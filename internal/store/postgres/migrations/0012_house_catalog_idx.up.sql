@@ -0,0 +1,11 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The catalog searches addresses by substring, ignoring case.
+CREATE INDEX houses_address_trgm_idx ON houses USING gin (lower(address) gin_trgm_ops);
+
+-- The catalog is paged by (sort key, house_number).
+CREATE INDEX houses_created_at_idx ON houses (created_at, house_number);
+CREATE INDEX houses_last_flat_added_at_idx ON houses (last_flat_added_at, house_number);
+
+-- Approved flat counts of the catalog.
+CREATE INDEX flats_house_approved_idx ON flats (house_id) WHERE status = 'approved';
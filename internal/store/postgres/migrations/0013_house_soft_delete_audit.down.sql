@@ -0,0 +1,2 @@
+DROP TABLE audit_events;
+ALTER TABLE houses DROP COLUMN deleted_at;
@@ -0,0 +1,15 @@
+-- Houses are deleted by setting deleted_at, so their flats are kept.
+ALTER TABLE houses ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    entity TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX audit_events_entity_idx ON audit_events (entity, entity_id, id);
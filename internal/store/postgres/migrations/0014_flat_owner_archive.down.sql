@@ -0,0 +1,2 @@
+ALTER TABLE flats DROP COLUMN archived_at;
+ALTER TABLE flats DROP COLUMN owner;
@@ -0,0 +1,4 @@
+-- Flats created before owners were recorded have none and can only be
+-- edited by moderators.
+ALTER TABLE flats ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE flats ADD COLUMN archived_at TIMESTAMP;
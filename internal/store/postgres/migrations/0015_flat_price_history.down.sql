@@ -0,0 +1 @@
+DROP TABLE flat_price_history;
@@ -0,0 +1,13 @@
+CREATE TABLE flat_price_history (
+	id BIGSERIAL PRIMARY KEY,
+	flat_id BIGINT NOT NULL REFERENCES flats(id) ON DELETE CASCADE,
+	price INT NOT NULL,
+	changed_by TEXT NOT NULL,
+	changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX flat_price_history_flat_idx ON flat_price_history (flat_id, id);
+
+-- Existing flats start their history at the price they are listed at.
+INSERT INTO flat_price_history (flat_id, price, changed_by, changed_at)
+SELECT id, price, owner, created_at FROM flats;
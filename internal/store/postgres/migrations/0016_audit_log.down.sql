@@ -0,0 +1,10 @@
+DROP TRIGGER audit_events_no_truncate ON audit_events;
+DROP TRIGGER audit_events_append_only ON audit_events;
+DROP FUNCTION audit_events_append_only();
+
+DROP INDEX audit_events_request_idx;
+DROP INDEX audit_events_action_idx;
+DROP INDEX audit_events_actor_idx;
+
+ALTER TABLE audit_events DROP COLUMN request_id;
+ALTER TABLE audit_events DROP COLUMN role;
@@ -0,0 +1,23 @@
+-- Every write of the API is audited with the role of its actor and the id of
+-- the request that made it.
+ALTER TABLE audit_events ADD COLUMN role TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_events ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_actor_idx ON audit_events (actor, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_request_idx ON audit_events (request_id);
+
+-- The audit log is append-only.
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+	BEFORE TRUNCATE ON audit_events
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
@@ -0,0 +1 @@
+DROP TABLE flat_moderation_history;
@@ -0,0 +1,13 @@
+-- Approvals and declines of flats, with the reason and comment of the
+-- moderator for the owner.
+CREATE TABLE flat_moderation_history (
+	id BIGSERIAL PRIMARY KEY,
+	flat_id BIGINT NOT NULL REFERENCES flats(id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	comment TEXT NOT NULL DEFAULT '',
+	moderator TEXT NOT NULL,
+	decided_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX flat_moderation_history_flat_idx ON flat_moderation_history (flat_id, id);
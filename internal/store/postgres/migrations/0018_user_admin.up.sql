@@ -0,0 +1,16 @@
+-- Disabled accounts keep their rows, so that their flats and audit records
+-- still point somewhere.
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
+
+-- Moderators and admins register by invitation. Only a hash of the token
+-- is stored.
+CREATE TABLE invitations (
+	id BIGSERIAL PRIMARY KEY,
+	token_hash TEXT NOT NULL UNIQUE,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	created_by TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- Publishers and in-process consumers that already have the event, so
+-- that retries skip them.
+ALTER TABLE outbox ADD COLUMN delivered_to TEXT[] NOT NULL DEFAULT '{}';
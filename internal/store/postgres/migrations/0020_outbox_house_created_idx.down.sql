@@ -0,0 +1 @@
+DROP INDEX IF EXISTS outbox_house_created_idx;
@@ -0,0 +1,3 @@
+-- Resumed live feeds read again the events created shortly before the last
+-- one they got.
+CREATE INDEX outbox_house_created_idx ON outbox (house_id, created_at);
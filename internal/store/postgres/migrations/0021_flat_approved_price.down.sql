@@ -0,0 +1 @@
+ALTER TABLE flats DROP COLUMN approved_price;
@@ -0,0 +1,5 @@
+-- The price of a flat at its last approval, so that subscribers hear about
+-- flats approved again cheaper. Zero if the flat was never approved.
+ALTER TABLE flats ADD COLUMN approved_price INT NOT NULL DEFAULT 0;
+
+UPDATE flats SET approved_price = price WHERE status = 'approved';
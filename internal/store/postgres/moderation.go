@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Moderation lease methods
+// ExtendFlatLease only moves the expiry. A lease is not a change of the
+// flat, so it neither bumps the version nor writes an audit record.
+func (db *PostgresDB) ExtendFlatLease(ctx context.Context, houseNumber, flatNumber int64, moderator string, expiresAt time.Time) error {
+	res, err := db.DB.ExecContext(ctx, `
+		UPDATE flats SET lease_expires_at = $1
+		WHERE house_id = $2 AND flat_number = $3
+			AND status = $4 AND moderator = $5 AND lease_expires_at > $6 AND `+liveFlat,
+		expiresAt.UTC(), houseNumber, flatNumber, store.StatusOnModeration, moderator, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrLeaseNotHeld
+	}
+	return nil
+}
+
+func (db *PostgresDB) ReleaseFlatLease(ctx context.Context, houseNumber, flatNumber int64) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := lockFlat(ctx, tx, houseNumber, flatNumber)
+	if err != nil {
+		return err
+	}
+
+	if err := store.CheckTransitionRole(current.Status, store.StatusCreated, store.RoleSystem); err != nil {
+		return err
+	}
+
+	var f store.Flat
+	row := tx.QueryRowContext(ctx, `
+		UPDATE flats SET status = $1, moderator = '', moderation_started_at = NULL, lease_expires_at = NULL,
+			version = version + 1
+		WHERE id = $2
+		RETURNING `+flatColumns,
+		store.StatusCreated, current.ID)
+	if err := scanFlat(row, &f); err != nil {
+		return err
+	}
+	if err := insertFlatEvent(ctx, tx, store.EventFlatStatusChanged, f); err != nil {
+		return err
+	}
+	if err := insertFlatAudit(ctx, tx, store.AuditFlatStatusChanged, &current, &f, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) ReleaseExpiredLeases(ctx context.Context, now time.Time) (int64, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The expired flats are read first, so that the audit log has them as
+	// they were. Flats locked by a moderator deciding them right now are
+	// left to the next sweep.
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+flatColumns+`, moderator FROM flats
+		WHERE status = $1 AND lease_expires_at <= $2 AND `+liveFlat+`
+		FOR UPDATE SKIP LOCKED`,
+		store.StatusOnModeration, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []store.Flat
+	for rows.Next() {
+		var f store.Flat
+		if err := rows.Scan(append(flatFields(&f), &f.Moderator)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, current := range expired {
+		var f store.Flat
+		row := tx.QueryRowContext(ctx, `
+			UPDATE flats SET status = $1, moderator = '', moderation_started_at = NULL, lease_expires_at = NULL,
+				version = version + 1
+			WHERE id = $2
+			RETURNING `+flatColumns,
+			store.StatusCreated, current.ID)
+		if err := scanFlat(row, &f); err != nil {
+			return 0, err
+		}
+		if err := insertFlatEvent(ctx, tx, store.EventFlatStatusChanged, f); err != nil {
+			return 0, err
+		}
+		if err := insertFlatAudit(ctx, tx, store.AuditFlatStatusChanged, &current, &f, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(expired)), nil
+}
+
+// Moderation queue methods
+func (db *PostgresDB) ClaimNextFlat(ctx context.Context, filter store.ModerationQueueFilter, moderator string, startedAt, leaseExpiresAt time.Time) (*store.Flat, error) {
+	where, args := queueConditions(filter, nil)
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets concurrent moderators pass over a flat someone else
+	// is claiming instead of waiting for it and then getting it too. The
+	// status condition makes this the created -> on moderation transition.
+	var current store.Flat
+	row := tx.QueryRowContext(ctx, `
+		SELECT `+flatColumns+`, moderator FROM flats WHERE `+where+`
+		ORDER BY created_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`,
+		args...)
+	err = row.Scan(append(flatFields(&current), &current.Moderator)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f store.Flat
+	row = tx.QueryRowContext(ctx, `
+		UPDATE flats SET status = $1, moderator = $2, moderation_started_at = $3, lease_expires_at = $4,
+			version = version + 1
+		WHERE id = $5
+		RETURNING `+flatColumns,
+		store.StatusOnModeration, moderator, startedAt.UTC(), leaseExpiresAt.UTC(), current.ID)
+	if err := scanFlat(row, &f); err != nil {
+		return nil, err
+	}
+	if err := insertFlatEvent(ctx, tx, store.EventFlatStatusChanged, f); err != nil {
+		return nil, err
+	}
+	if err := insertFlatAudit(ctx, tx, store.AuditFlatStatusChanged, &current, &f, startedAt); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (db *PostgresDB) ListModerationQueue(ctx context.Context, filter store.ModerationQueueFilter) ([]store.Flat, error) {
+	where, args := queueConditions(filter, nil)
+	query := `
+		SELECT id, house_id, flat_number, price, rooms, status, created_at, version
+		FROM flats WHERE ` + where + `
+		ORDER BY created_at, id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flats []store.Flat
+	for rows.Next() {
+		var f store.Flat
+		if err := rows.Scan(&f.ID, &f.HouseNumber, &f.FlatNumber, &f.Price, &f.Rooms, &f.Status, &f.CreatedAt, &f.Version); err != nil {
+			return nil, err
+		}
+		flats = append(flats, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return flats, nil
+}
+
+// queueConditions builds the WHERE clause selecting flats waiting for
+// review, numbering its placeholders after args.
+func queueConditions(filter store.ModerationQueueFilter, args []interface{}) (string, []interface{}) {
+	add := func(cond string, arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf(cond, len(args))
+	}
+
+	conds := []string{add("status = $%d", store.StatusCreated), liveFlat}
+	if filter.HouseNumber != 0 {
+		conds = append(conds, add("house_id = $%d", filter.HouseNumber))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conds = append(conds, add("created_at <= $%d", filter.CreatedBefore.UTC()))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conds = append(conds, add("created_at >= $%d", filter.CreatedAfter.UTC()))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// Moderation history methods
+
+// insertModerationDecision adds a decision to the history of a flat as part
+// of tx.
+func insertModerationDecision(ctx context.Context, tx *sql.Tx, d store.ModerationDecision) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO flat_moderation_history (flat_id, status, reason, comment, moderator, decided_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		d.FlatID, d.Status, d.Reason, d.Comment, d.Moderator, d.DecidedAt.UTC())
+	return err
+}
+
+func (db *PostgresDB) ListModerationDecisions(ctx context.Context, flatID int64) ([]store.ModerationDecision, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT flat_id, status, reason, comment, moderator, decided_at FROM flat_moderation_history
+		WHERE flat_id = $1 ORDER BY id`, flatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []store.ModerationDecision
+	for rows.Next() {
+		var d store.ModerationDecision
+		if err := rows.Scan(&d.FlatID, &d.Status, &d.Reason, &d.Comment, &d.Moderator, &d.DecidedAt); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/lib/pq"
+)
+
+const eventColumns = `id, event_type, house_id, payload, created_at, status, attempts, next_attempt_at,
+	last_error, published_at, delivered_to`
+
+// insertEvent records the event in the outbox as part of tx, so it is
+// published if and only if the change that caused it is committed. Listeners
+// on EventsChannel are notified on commit as well.
+func insertEvent(ctx context.Context, tx *sql.Tx, e store.Event) error {
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO outbox (event_type, house_id, payload, created_at, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		e.Type, e.HouseNumber, []byte(e.Payload), e.CreatedAt.UTC(), store.EventPending, e.NextAttemptAt.UTC(),
+	).Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := notificationPayload(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, EventsChannel, payload)
+	return err
+}
+
+func insertFlatEvent(ctx context.Context, tx *sql.Tx, eventType string, flat store.Flat) error {
+	event, err := store.NewFlatEvent(eventType, flat, time.Now())
+	if err != nil {
+		return err
+	}
+	return insertEvent(ctx, tx, event)
+}
+
+// Outbox methods
+func (db *PostgresDB) ClaimOutboxEvents(ctx context.Context, now, claimUntil time.Time, limit int) ([]store.Event, error) {
+	// Moving next_attempt_at hides the claimed events from other relays.
+	// If this relay dies before marking them, they are retried once the
+	// claim runs out.
+	rows, err := db.DB.QueryContext(ctx, `
+		UPDATE outbox SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+eventColumns,
+		claimUntil.UTC(), store.EventPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING doesn't keep the order of the subquery.
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+func (db *PostgresDB) MarkEventPublished(ctx context.Context, id int64, at time.Time) error {
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE outbox SET status = $1, attempts = attempts + 1, published_at = $2, last_error = ''
+		WHERE id = $3`,
+		store.EventPublished, at.UTC(), id)
+	return err
+}
+
+func (db *PostgresDB) MarkEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time, dead bool, deliveredTo []string) error {
+	status := store.EventPending
+	if dead {
+		status = store.EventDead
+	}
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE outbox SET status = $1, attempts = attempts + 1, next_attempt_at = $2, last_error = $3,
+			delivered_to = $4
+		WHERE id = $5`,
+		status, nextAttemptAt.UTC(), lastError, pq.Array(deliveredTo), id)
+	return err
+}
+
+func (db *PostgresDB) ListHouseEvents(ctx context.Context, houseNumber, afterID int64, limit int) ([]store.Event, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT `+eventColumns+` FROM outbox
+		WHERE house_id = $1 AND id > $2
+		ORDER BY id LIMIT $3`,
+		houseNumber, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func (db *PostgresDB) ListLateHouseEvents(ctx context.Context, houseNumber, beforeID int64, window time.Duration) ([]store.Event, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT `+eventColumns+` FROM outbox
+		WHERE house_id = $1 AND id < $2
+			AND created_at >= (SELECT created_at FROM outbox WHERE id = $2) - make_interval(secs => $3)
+		ORDER BY id`,
+		houseNumber, beforeID, window.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func scanEvents(rows *sql.Rows) ([]store.Event, error) {
+	defer rows.Close()
+
+	var events []store.Event
+	for rows.Next() {
+		var e store.Event
+		var payload []byte
+		err := rows.Scan(&e.ID, &e.Type, &e.HouseNumber, &payload, &e.CreatedAt, &e.Status, &e.Attempts,
+			&e.NextAttemptAt, &e.LastError, &e.PublishedAt, pq.Array(&e.DeliveredTo))
+		if err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
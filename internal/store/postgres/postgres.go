@@ -1,77 +1,116 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"avtest/internal/store"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+// liveFlat limits flats to those that have not been archived, in houses
+// that have not been deleted.
+const liveFlat = `archived_at IS NULL AND house_id IN (SELECT house_number FROM houses WHERE deleted_at IS NULL)`
+
+// userColumns are the user columns read by scanUser.
+const userColumns = `id, email, password, type, disabled_at`
+
+// flatColumns are the flat columns read by scanFlat.
+const flatColumns = `id, house_id, flat_number, price, rooms, status, created_at, moderation_started_at, lease_expires_at, version,
+	owner, archived_at, approved_price`
+
 type PostgresDB struct {
 	DB *sql.DB
 }
 
+// NewPostgresDB connects to the database and brings its schema up to date.
+// It refuses to start when the schema is ahead of the embedded migrations.
 func NewPostgresDB(dsn string) (*PostgresDB, error) {
-	dbConn, err := sql.Open("postgres", dsn)
+	db, err := Connect(dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	db := &PostgresDB{DB: dbConn}
-	err = db.CreateTable()
-	if err != nil {
+	if err := db.CheckSchema(); err != nil {
+		db.DB.Close()
+		return nil, err
+	}
+	if err := db.MigrateUp(); err != nil {
+		db.DB.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func (db *PostgresDB) CreateTable() error {
-	_, err := db.DB.Exec(`
--- 		DROP TABLE flats;
--- 		DROP TABLE houses;
--- 		DROP TABLE users;
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL,
-			type TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS houses (
-			id SERIAL PRIMARY KEY,
-			house_number INTEGER UNIQUE NOT NULL,
-			address TEXT NOT NULL,
-			year_built INTEGER NOT NULL,
-			developer TEXT,
-			created_at TIMESTAMP NOT NULL,
-			last_flat_added_at TIMESTAMP
-		);
-		CREATE TABLE IF NOT EXISTS flats (
-			id SERIAL PRIMARY KEY,
-			house_id INTEGER REFERENCES houses(house_number) ON DELETE CASCADE,
-			flat_number INTEGER NOT NULL,
-			price INTEGER NOT NULL,
-			rooms INTEGER NOT NULL,
-			status TEXT NOT NULL,
-		    moderator TEXT DEFAULT '' NOT NULL
-		);
-	`)
-	return err
+// Connect opens a connection pool without touching the schema.
+func Connect(dsn string) (*PostgresDB, error) {
+	dbConn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostgresDB{DB: dbConn}, nil
 }
 
 // User methods
-func (db *PostgresDB) CreateUser(user *store.User) error {
-	_, err := db.DB.Exec("INSERT INTO users (email, password, type) VALUES ($1, $2, $3)",
-		user.Email, user.Password, user.Type)
-	return err
+func (db *PostgresDB) CreateUser(ctx context.Context, user *store.User) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx, user, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertUser stores the user, sets its ID and records the registration as
+// part of tx.
+func insertUser(ctx context.Context, tx *sql.Tx, user *store.User, at time.Time) error {
+	err := tx.QueryRowContext(ctx, "INSERT INTO users (email, password, type) VALUES ($1, $2, $3) RETURNING id",
+		user.Email, user.Password, user.Type).Scan(&user.ID)
+	if err != nil {
+		return mapError(err)
+	}
+
+	record, err := store.NewRegistrationAuditRecord(ctx, *user, at)
+	if err != nil {
+		return err
+	}
+	return insertAuditRecord(ctx, tx, &record)
+}
+
+func (db *PostgresDB) GetUserByEmail(ctx context.Context, email string) (*store.User, error) {
+	row := db.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email)
+	var user store.User
+	err := scanUser(row, &user)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func (db *PostgresDB) GetUserByEmail(email string) (*store.User, error) {
-	row := db.DB.QueryRow("SELECT id, email, password, type FROM users WHERE email = $1", email)
+func (db *PostgresDB) GetUserByID(ctx context.Context, id int64) (*store.User, error) {
+	row := db.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id)
 	var user store.User
-	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Type)
+	err := scanUser(row, &user)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -81,22 +120,103 @@ func (db *PostgresDB) GetUserByEmail(email string) (*store.User, error) {
 	return &user, nil
 }
 
+func (db *PostgresDB) ListUsers(ctx context.Context) ([]store.User, error) {
+	rows, err := db.DB.QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []store.User
+	for rows.Next() {
+		var user store.User
+		if err := scanUser(rows, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (db *PostgresDB) UpdateUserPassword(ctx context.Context, id int64, password string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", password, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+
+	record, err := store.NewAuditRecord(ctx, store.AuditUserPasswordRehashed, store.AuditEntityUser,
+		strconv.FormatInt(id, 10), nil, nil, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // House methods
-func (db *PostgresDB) CreateHouse(house *store.House) error {
-	_, err := db.DB.Exec(`
+func (db *PostgresDB) CreateHouse(ctx context.Context, house *store.House) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	h := *house
+	err = tx.QueryRowContext(ctx, `
 		INSERT INTO houses (house_number, address, year_built, developer, created_at, last_flat_added_at)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
-		house.HouseNumber, house.Address, house.YearBuilt, house.Developer, house.CreatedAt, house.LastFlatAddedAt)
-	return err
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING version`,
+		house.HouseNumber, house.Address, house.YearBuilt, house.Developer, house.CreatedAt, house.LastFlatAddedAt,
+	).Scan(&h.Version)
+	if err != nil {
+		return mapError(err)
+	}
+
+	event, err := store.NewHouseEvent(store.EventHouseCreated, h, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := insertEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := insertHouseAudit(ctx, tx, store.AuditHouseCreated, nil, &h, h.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	house.Version = h.Version
+	return nil
 }
 
-func (db *PostgresDB) GetHouseByID(id int64) (*store.House, error) {
-	row := db.DB.QueryRow(`
-		SELECT house_number, address, year_built, developer, created_at, last_flat_added_at
-		FROM houses WHERE id = $1`, id)
+func (db *PostgresDB) GetHouseByID(ctx context.Context, id int64) (*store.House, error) {
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT house_number, address, year_built, developer, created_at, last_flat_added_at, version
+		FROM houses WHERE house_number = $1 AND deleted_at IS NULL`, id)
 	var house store.House
 	err := row.Scan(&house.HouseNumber, &house.Address, &house.YearBuilt, &house.Developer,
-		&house.CreatedAt, &house.LastFlatAddedAt)
+		&house.CreatedAt, &house.LastFlatAddedAt, &house.Version)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -106,30 +226,228 @@ func (db *PostgresDB) GetHouseByID(id int64) (*store.House, error) {
 	return &house, nil
 }
 
-func (db *PostgresDB) UpdateHouse(house *store.House) error {
-	_, err := db.DB.Exec(`
-		UPDATE houses SET address = $1, year_built = $2, developer = $3,
-		created_at = $4, last_flat_added_at = $5 WHERE id = $6`,
-		house.Address, house.YearBuilt, house.Developer, house.CreatedAt,
-		house.LastFlatAddedAt, house.HouseNumber)
-	return err
+// houseSortColumns maps house sort keys to columns.
+var houseSortColumns = map[string]string{
+	store.SortByCreatedAt:       "h.created_at",
+	store.SortByLastFlatAddedAt: "h.last_flat_added_at",
+}
+
+func (db *PostgresDB) ListHouses(ctx context.Context, query store.HouseQuery) ([]store.HouseSummary, error) {
+	column, ok := houseSortColumns[query.SortBy]
+	if !ok {
+		column = houseSortColumns[store.SortByCreatedAt]
+	}
+	order, after := "ASC", ">"
+	if query.Desc {
+		order, after = "DESC", "<"
+	}
+
+	args := []interface{}{store.StatusApproved}
+	add := func(cond string, arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf(cond, len(args))
+	}
+
+	conds := []string{"h.deleted_at IS NULL"}
+	if query.Address != "" {
+		conds = append(conds, add("lower(h.address) LIKE $%d", "%"+escapeLike(strings.ToLower(query.Address))+"%"))
+	}
+	if query.Developer != "" {
+		conds = append(conds, add("lower(h.developer) = lower($%d)", query.Developer))
+	}
+	if query.MinYearBuilt != 0 {
+		conds = append(conds, add("h.year_built >= $%d", query.MinYearBuilt))
+	}
+	if query.MaxYearBuilt != 0 {
+		conds = append(conds, add("h.year_built <= $%d", query.MaxYearBuilt))
+	}
+	if query.HasApprovedFlats {
+		conds = append(conds, "EXISTS (SELECT 1 FROM flats f WHERE f.house_id = h.house_number AND f.status = $1 AND f.archived_at IS NULL)")
+	}
+	if query.After != nil {
+		value := add("$%d", query.After.Time.UTC())
+		conds = append(conds, fmt.Sprintf("(%s, h.house_number) %s (%s, %s)", column, after, value, add("$%d", query.After.HouseNumber)))
+	}
+
+	sqlQuery := `
+		SELECT h.house_number, h.address, h.year_built, h.developer, h.created_at, h.last_flat_added_at, h.version,
+			(SELECT count(*) FROM flats f WHERE f.house_id = h.house_number AND f.status = $1 AND f.archived_at IS NULL)
+		FROM houses h
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY ` + column + ` ` + order + `, h.house_number ` + order
+	if query.Limit > 0 {
+		sqlQuery += add(" LIMIT $%d", query.Limit)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var houses []store.HouseSummary
+	for rows.Next() {
+		var h store.HouseSummary
+		if err := rows.Scan(&h.HouseNumber, &h.Address, &h.YearBuilt, &h.Developer, &h.CreatedAt,
+			&h.LastFlatAddedAt, &h.Version, &h.ApprovedFlats); err != nil {
+			return nil, err
+		}
+		houses = append(houses, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return houses, nil
+}
+
+// escapeLike makes s match literally in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (db *PostgresDB) UpdateHouse(ctx context.Context, update store.HouseUpdate) (*store.House, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := lockHouse(ctx, tx, update.HouseNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.CheckVersion("house", update.ExpectedVersion, current.Version); err != nil {
+		return nil, err
+	}
+
+	h := update.Apply(current)
+	err = tx.QueryRowContext(ctx, `
+		UPDATE houses SET address = $1, year_built = $2, developer = $3, version = version + 1
+		WHERE house_number = $4 RETURNING version`,
+		h.Address, h.YearBuilt, h.Developer, h.HouseNumber).Scan(&h.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertHouseAudit(ctx, tx, store.AuditHouseUpdated, &current, &h, update.At); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// DeleteHouse only marks the house deleted. Removing the row would cascade
+// to its flats.
+func (db *PostgresDB) DeleteHouse(ctx context.Context, houseNumber, expectedVersion int64, at time.Time) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := lockHouse(ctx, tx, houseNumber)
+	if err != nil {
+		return err
+	}
+	if err := store.CheckVersion("house", expectedVersion, current.Version); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE houses SET deleted_at = $1, version = version + 1 WHERE house_number = $2`,
+		at.UTC(), houseNumber)
+	if err != nil {
+		return err
+	}
+
+	if err := insertHouseAudit(ctx, tx, store.AuditHouseDeleted, &current, nil, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockHouse reads a house that has not been deleted and locks its row until
+// tx ends.
+func lockHouse(ctx context.Context, tx *sql.Tx, houseNumber int64) (store.House, error) {
+	var h store.House
+	err := tx.QueryRowContext(ctx, `
+		SELECT house_number, address, year_built, developer, created_at, last_flat_added_at, version
+		FROM houses WHERE house_number = $1 AND deleted_at IS NULL FOR UPDATE`, houseNumber,
+	).Scan(&h.HouseNumber, &h.Address, &h.YearBuilt, &h.Developer, &h.CreatedAt, &h.LastFlatAddedAt, &h.Version)
+	if err == sql.ErrNoRows {
+		return store.House{}, store.ErrHouseNotFound
+	}
+	return h, err
 }
 
 // Flat methods
-func (db *PostgresDB) CreateFlat(flat *store.Flat) error {
-	_, err := db.DB.Exec(`INSERT INTO flats (house_id, flat_number, price, rooms, status) 
-		VALUES ($1, $2, $3, $4, $5)`,
-		flat.HouseNumber, flat.FlatNumber, flat.Price, flat.Rooms, flat.Status)
-	return err
+// CreateFlat adds the flat and moves the last_flat_added_at of its house.
+func (db *PostgresDB) CreateFlat(ctx context.Context, flat *store.Flat) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Updating the house first locks it against a concurrent delete.
+	res, err := tx.ExecContext(ctx, `
+		UPDATE houses SET last_flat_added_at = $1, version = version + 1
+		WHERE house_number = $2 AND deleted_at IS NULL`,
+		flat.CreatedAt, flat.HouseNumber)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrHouseNotFound
+	}
+
+	f := *flat
+	err = tx.QueryRowContext(ctx, `INSERT INTO flats (house_id, flat_number, price, rooms, status, created_at, owner) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, version`,
+		flat.HouseNumber, flat.FlatNumber, flat.Price, flat.Rooms, flat.Status, flat.CreatedAt.UTC(), flat.Owner,
+	).Scan(&f.ID, &f.Version)
+	if err != nil {
+		return mapError(err)
+	}
+
+	err = insertFlatPrice(ctx, tx, store.FlatPrice{FlatID: f.ID, Price: f.Price, ChangedBy: f.Owner, ChangedAt: f.CreatedAt})
+	if err != nil {
+		return err
+	}
+
+	event, err := store.NewFlatEvent(store.EventFlatCreated, f, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := insertEvent(ctx, tx, event); err != nil {
+		return err
+	}
+	if err := insertFlatAudit(ctx, tx, store.AuditFlatCreated, nil, &f, f.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	flat.ID, flat.Version = f.ID, f.Version
+	return nil
 }
 
-func (db *PostgresDB) GetFlat(houseNumber, flatNumber int64) (*store.Flat, error) {
+func (db *PostgresDB) GetFlat(ctx context.Context, houseNumber, flatNumber int64) (*store.Flat, error) {
 	var flat store.Flat
-	row := db.DB.QueryRow(`
-		SELECT id, house_id, flat_number, price, rooms, status 
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT `+flatColumns+`
 		FROM flats 
-		WHERE house_id = $1 AND flat_number = $2`, houseNumber, flatNumber)
-	err := row.Scan(&flat.ID, &flat.HouseNumber, &flat.FlatNumber, &flat.Price, &flat.Rooms, &flat.Status)
+		WHERE house_id = $1 AND flat_number = $2 AND `+liveFlat, houseNumber, flatNumber)
+	err := scanFlat(row, &flat)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -139,30 +457,74 @@ func (db *PostgresDB) GetFlat(houseNumber, flatNumber int64) (*store.Flat, error
 	return &flat, nil
 }
 
-func (db *PostgresDB) UpdateHouseFlatTime(time time.Time) error {
-	_, err := db.DB.Exec(`UPDATE houses SET last_flat_added_at = $1`, time)
-	return err
+// flatSortColumns maps flat sort keys to columns.
+var flatSortColumns = map[string]string{
+	store.SortByFlatNumber: "flat_number",
+	store.SortByPrice:      "price",
+	store.SortByRooms:      "rooms",
 }
 
-func (db *PostgresDB) GetFlatsByHouseID(houseID int64, userType string) ([]store.Flat, error) {
-	var flats []store.Flat
-	query := `SELECT id, house_id, flat_number, price, rooms, status FROM flats WHERE house_id = $1`
+func (db *PostgresDB) GetFlatsByHouseID(ctx context.Context, houseID int64, query store.FlatQuery) ([]store.Flat, error) {
+	column, ok := flatSortColumns[query.SortBy]
+	if !ok {
+		column = flatSortColumns[store.SortByFlatNumber]
+	}
+	order, after := "ASC", ">"
+	if query.Desc {
+		order, after = "DESC", "<"
+	}
+
 	args := []interface{}{houseID}
+	add := func(cond string, arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf(cond, len(args))
+	}
+
+	conds := []string{"house_id = $1", liveFlat}
+	if query.Role != "" && !store.SeesAllFlats(query.Role) {
+		conds = append(conds, add("status = $%d", store.StatusApproved))
+	}
+	if query.Status != "" {
+		conds = append(conds, add("status = $%d", query.Status))
+	}
+	if query.MinPrice != 0 {
+		conds = append(conds, add("price >= $%d", query.MinPrice))
+	}
+	if query.MaxPrice != 0 {
+		conds = append(conds, add("price <= $%d", query.MaxPrice))
+	}
+	if query.Rooms != 0 {
+		conds = append(conds, add("rooms = $%d", query.Rooms))
+	}
+	if query.MinFlatNumber != 0 {
+		conds = append(conds, add("flat_number >= $%d", query.MinFlatNumber))
+	}
+	if query.MaxFlatNumber != 0 {
+		conds = append(conds, add("flat_number <= $%d", query.MaxFlatNumber))
+	}
+	if query.After != nil {
+		value := add("$%d", query.After.Value)
+		conds = append(conds, fmt.Sprintf("(%s, id) %s (%s, %s)", column, after, value, add("$%d", query.After.ID)))
+	}
 
-	if userType == "client" {
-		query += ` AND status = $2`
-		args = append(args, "approved")
+	sqlQuery := `SELECT id, house_id, flat_number, price, rooms, status, created_at, version FROM flats
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY ` + column + ` ` + order + `, id ` + order
+	if query.Limit > 0 {
+		sqlQuery += add(" LIMIT $%d", query.Limit)
 	}
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := db.DB.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var flats []store.Flat
 	for rows.Next() {
 		var flat store.Flat
-		if err := rows.Scan(&flat.ID, &flat.HouseNumber, &flat.FlatNumber, &flat.Price, &flat.Rooms, &flat.Status); err != nil {
+		if err := rows.Scan(&flat.ID, &flat.HouseNumber, &flat.FlatNumber, &flat.Price, &flat.Rooms, &flat.Status,
+			&flat.CreatedAt, &flat.Version); err != nil {
 			return nil, err
 		}
 		flats = append(flats, flat)
@@ -175,22 +537,232 @@ func (db *PostgresDB) GetFlatsByHouseID(houseID int64, userType string) ([]store
 	return flats, nil
 }
 
-func (db *PostgresDB) GetFlatStatus(houseID int64, flatNumber int64) (store.Flat, error) {
+func (db *PostgresDB) GetFlatStatus(ctx context.Context, houseID int64, flatNumber int64) (store.Flat, error) {
 	var f store.Flat
-	row := db.DB.QueryRow(`SELECT * FROM flats WHERE house_id = $1 AND flat_number = $2`,
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT id, house_id, flat_number, price, rooms, status, moderator, created_at, moderation_started_at, lease_expires_at, version
+		FROM flats WHERE house_id = $1 AND flat_number = $2 AND `+liveFlat,
 		houseID, flatNumber)
 
-	if err := row.Scan(&f.ID, &f.HouseNumber, &f.FlatNumber, &f.Price, &f.Rooms, &f.Status, &f.Moderator); err != nil {
+	err := row.Scan(&f.ID, &f.HouseNumber, &f.FlatNumber, &f.Price, &f.Rooms, &f.Status, &f.Moderator,
+		&f.CreatedAt, &f.ModerationStartedAt, &f.LeaseExpiresAt, &f.Version)
+	if err == sql.ErrNoRows {
+		return store.Flat{}, store.ErrFlatNotFound
+	}
+	if err != nil {
 		return store.Flat{}, err
 	}
 
 	return f, nil
 }
 
-func (db *PostgresDB) UpdateFlat(flat *store.Flat, token string) error {
-	_, err := db.DB.Exec(`
-		UPDATE flats SET status = $1, moderator = $2
-		WHERE flat_number = $3 AND house_id = $4`,
-		flat.Status, token, flat.FlatNumber, flat.HouseNumber)
+// ChangeFlatStatus checks and applies the change while the flat row is
+// locked, so concurrent changes of the same flat are serialised.
+func (db *PostgresDB) ChangeFlatStatus(ctx context.Context, change store.FlatStatusChange) (*store.Flat, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := lockFlat(ctx, tx, change.HouseNumber, change.FlatNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.CheckStatusChange(current, change); err != nil {
+		return nil, err
+	}
+
+	var f store.Flat
+	row := tx.QueryRowContext(ctx, `
+		UPDATE flats SET status = $1, moderator = $2, moderation_started_at = $3, lease_expires_at = $4,
+			approved_price = CASE WHEN $1 = $6 THEN price ELSE approved_price END, version = version + 1
+		WHERE id = $5
+		RETURNING `+flatColumns,
+		change.Status, change.Actor, utcOrNil(change.ModerationStartedAt), utcOrNil(change.LeaseExpiresAt),
+		current.ID, store.StatusApproved)
+	if err := scanFlat(row, &f); err != nil {
+		return nil, err
+	}
+	event, err := store.NewFlatStatusEvent(f, current, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := insertEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+	if err := insertFlatAudit(ctx, tx, store.AuditFlatStatusChanged, &current, &f, change.At); err != nil {
+		return nil, err
+	}
+	if store.IsDecision(f.Status) {
+		err := insertModerationDecision(ctx, tx, store.ModerationDecision{FlatID: f.ID, Status: f.Status,
+			Reason: change.Reason, Comment: change.Comment, Moderator: change.Actor, DecidedAt: change.At})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// EditFlat checks and applies the edit while the flat row is locked.
+func (db *PostgresDB) EditFlat(ctx context.Context, edit store.FlatEdit) (*store.Flat, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := lockFlat(ctx, tx, edit.HouseNumber, edit.FlatNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.CheckFlatEdit(current, edit.Actor, edit.Role, edit.ExpectedVersion); err != nil {
+		return nil, err
+	}
+	status, err := store.ResubmittedStatus(current.Status, edit.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	price, rooms := current.Price, current.Rooms
+	if edit.Price != nil {
+		price = *edit.Price
+	}
+	if edit.Rooms != nil {
+		rooms = *edit.Rooms
+	}
+
+	var f store.Flat
+	row := tx.QueryRowContext(ctx, `
+		UPDATE flats SET price = $1, rooms = $2, status = $3, moderator = '', version = version + 1
+		WHERE id = $4
+		RETURNING `+flatColumns,
+		price, rooms, status, current.ID)
+	if err := scanFlat(row, &f); err != nil {
+		return nil, err
+	}
+
+	if err := insertFlatEvent(ctx, tx, store.EventFlatUpdated, f); err != nil {
+		return nil, err
+	}
+	if f.Price != current.Price {
+		err := insertFlatPrice(ctx, tx, store.FlatPrice{FlatID: f.ID, Price: f.Price, ChangedBy: edit.Actor, ChangedAt: edit.At})
+		if err != nil {
+			return nil, err
+		}
+		event, err := store.NewFlatPriceEvent(f, current, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if err := insertEvent(ctx, tx, event); err != nil {
+			return nil, err
+		}
+	}
+	if err := insertFlatAudit(ctx, tx, store.AuditFlatUpdated, &current, &f, edit.At); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// ArchiveFlat checks and archives the flat while its row is locked.
+func (db *PostgresDB) ArchiveFlat(ctx context.Context, archival store.FlatArchival) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := lockFlat(ctx, tx, archival.HouseNumber, archival.FlatNumber)
+	if err != nil {
+		return err
+	}
+	if err := store.CheckFlatEdit(current, archival.Actor, archival.Role, archival.ExpectedVersion); err != nil {
+		return err
+	}
+
+	var f store.Flat
+	row := tx.QueryRowContext(ctx, `
+		UPDATE flats SET archived_at = $1, version = version + 1 WHERE id = $2
+		RETURNING `+flatColumns,
+		archival.At.UTC(), current.ID)
+	if err := scanFlat(row, &f); err != nil {
+		return err
+	}
+
+	if err := insertFlatEvent(ctx, tx, store.EventFlatArchived, f); err != nil {
+		return err
+	}
+	if err := insertFlatAudit(ctx, tx, store.AuditFlatArchived, &current, nil, archival.At); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockFlat reads a flat that has not been archived, including its
+// moderator, and locks its row until tx ends.
+func lockFlat(ctx context.Context, tx *sql.Tx, houseNumber, flatNumber int64) (store.Flat, error) {
+	var f store.Flat
+	row := tx.QueryRowContext(ctx, `
+		SELECT `+flatColumns+`, moderator FROM flats
+		WHERE house_id = $1 AND flat_number = $2 AND `+liveFlat+` FOR UPDATE`,
+		houseNumber, flatNumber)
+	err := row.Scan(append(flatFields(&f), &f.Moderator)...)
+	if err == sql.ErrNoRows {
+		return store.Flat{}, store.ErrFlatNotFound
+	}
+	return f, err
+}
+
+// scanFlat reads a row selected with flatColumns.
+func scanFlat(row interface{ Scan(...interface{}) error }, f *store.Flat) error {
+	return row.Scan(flatFields(f)...)
+}
+
+// flatFields returns the destinations of flatColumns in f.
+func flatFields(f *store.Flat) []interface{} {
+	return []interface{}{&f.ID, &f.HouseNumber, &f.FlatNumber, &f.Price, &f.Rooms, &f.Status,
+		&f.CreatedAt, &f.ModerationStartedAt, &f.LeaseExpiresAt, &f.Version, &f.Owner, &f.ArchivedAt, &f.ApprovedPrice}
+}
+
+// utcOrNil converts an optional time for a TIMESTAMP column.
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// mapError translates constraint violations into store errors, so that
+// callers don't depend on the driver.
+func mapError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case uniqueViolation:
+		switch pqErr.Table {
+		case "users":
+			return store.ErrUserExists
+		case "houses":
+			return store.ErrHouseExists
+		}
+	case foreignKeyViolation:
+		switch pqErr.Table {
+		case "flats", "subscriptions":
+			return store.ErrHouseNotFound
+		}
+	}
 	return err
 }
@@ -0,0 +1,12 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeLike(t *testing.T) {
+	require.Equal(t, `50\% off\_sale \\ street`, escapeLike(`50% off_sale \ street`))
+	require.Equal(t, "lenina", escapeLike("lenina"))
+}
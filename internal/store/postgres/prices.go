@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"avtest/internal/store"
+)
+
+// insertFlatPrice adds a price to the history of a flat as part of tx.
+func insertFlatPrice(ctx context.Context, tx *sql.Tx, p store.FlatPrice) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO flat_price_history (flat_id, price, changed_by, changed_at) VALUES ($1, $2, $3, $4)`,
+		p.FlatID, p.Price, p.ChangedBy, p.ChangedAt.UTC())
+	return err
+}
+
+func (db *PostgresDB) ListFlatPrices(ctx context.Context, flatID int64) ([]store.FlatPrice, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT flat_id, price, changed_by, changed_at FROM flat_price_history
+		WHERE flat_id = $1 ORDER BY id`, flatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []store.FlatPrice
+	for rows.Next() {
+		var p store.FlatPrice
+		if err := rows.Scan(&p.FlatID, &p.Price, &p.ChangedBy, &p.ChangedAt); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
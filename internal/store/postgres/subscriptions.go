@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Subscription methods
+func (db *PostgresDB) CreateSubscription(ctx context.Context, sub *store.Subscription) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO subscriptions (email, house_id, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (house_id, email) DO NOTHING`,
+		sub.Email, sub.HouseNumber, sub.CreatedAt.UTC())
+	if err != nil {
+		return mapError(err)
+	}
+
+	record, err := store.NewAuditRecord(ctx, store.AuditSubscriptionCreated, store.AuditEntitySubscription,
+		strconv.FormatInt(sub.HouseNumber, 10), nil, sub, sub.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) DeleteSubscription(ctx context.Context, email string, houseNumber int64) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sub store.Subscription
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM subscriptions WHERE email = $1 AND house_id = $2
+		RETURNING id, email, house_id, created_at`, email, houseNumber,
+	).Scan(&sub.ID, &sub.Email, &sub.HouseNumber, &sub.CreatedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	record, err := store.NewAuditRecord(ctx, store.AuditSubscriptionDeleted, store.AuditEntitySubscription,
+		strconv.FormatInt(houseNumber, 10), sub, nil, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) GetHouseSubscribers(ctx context.Context, houseNumber int64) ([]string, error) {
+	rows, err := db.DB.QueryContext(ctx, `SELECT email FROM subscriptions WHERE house_id = $1 ORDER BY id`, houseNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Refresh token methods
+func (db *PostgresDB) CreateRefreshToken(ctx context.Context, token *store.RefreshToken) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertRefreshToken(ctx, tx, token); err != nil {
+		return err
+	}
+	if err := insertSessionAudit(ctx, tx, store.AuditUserLoggedIn, token.Subject, nil, token.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertRefreshToken(ctx context.Context, tx *sql.Tx, token *store.RefreshToken) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, subject, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		token.TokenHash, token.FamilyID, token.Subject, token.CreatedAt.UTC(), token.ExpiresAt.UTC())
+	return err
+}
+
+// insertSessionAudit records a session action of the subject as part of tx.
+func insertSessionAudit(ctx context.Context, tx *sql.Tx, action, subject string, after interface{}, at time.Time) error {
+	record, err := store.NewAuditRecord(ctx, action, store.AuditEntityUser, subject, nil, after, at)
+	if err != nil {
+		return err
+	}
+	return insertAuditRecord(ctx, tx, &record)
+}
+
+func (db *PostgresDB) GetRefreshToken(ctx context.Context, tokenHash string) (*store.RefreshToken, error) {
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT id, token_hash, family_id, subject, created_at, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1`, tokenHash)
+	var t store.RefreshToken
+	err := row.Scan(&t.ID, &t.TokenHash, &t.FamilyID, &t.Subject, &t.CreatedAt, &t.ExpiresAt,
+		&t.UsedAt, &t.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (db *PostgresDB) RotateRefreshToken(ctx context.Context, oldHash string, next *store.RefreshToken) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET used_at = $1
+		WHERE token_hash = $2 AND used_at IS NULL AND revoked_at IS NULL`,
+		next.CreatedAt.UTC(), oldHash)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrRefreshTokenReused
+	}
+
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return err
+	}
+	if err := insertSessionAudit(ctx, tx, store.AuditUserTokenRefreshed, next.Subject, nil, next.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) RevokeRefreshTokenFamily(ctx context.Context, token store.RefreshToken) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := revokeRefreshTokenFamily(ctx, tx, token.FamilyID, now); err != nil {
+		return err
+	}
+	err = insertSessionAudit(ctx, tx, store.AuditUserTokenReused, token.Subject,
+		map[string]string{"family_id": token.FamilyID}, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func revokeRefreshTokenFamily(ctx context.Context, tx *sql.Tx, familyID string, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE family_id = $2 AND revoked_at IS NULL`, at.UTC(), familyID)
+	return err
+}
+
+func (db *PostgresDB) RevokeSubjectRefreshTokens(ctx context.Context, subject string) error {
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE subject = $2 AND revoked_at IS NULL`, time.Now().UTC(), subject)
+	return err
+}
+
+// Access token revocation methods
+func (db *PostgresDB) Logout(ctx context.Context, logout store.Logout) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if logout.FamilyID != "" {
+		if err := revokeRefreshTokenFamily(ctx, tx, logout.FamilyID, logout.At); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING`, logout.TokenID, logout.ExpiresAt.UTC())
+	if err != nil {
+		return err
+	}
+	// Entries for expired tokens are useless, so the list is trimmed on
+	// every write instead of by a separate job.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, logout.At.UTC()); err != nil {
+		return err
+	}
+
+	if err := insertSessionAudit(ctx, tx, store.AuditUserLoggedOut, logout.Subject, nil, logout.At); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) LogoutAll(ctx context.Context, subject string, at time.Time) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = $1
+		WHERE subject = $2 AND revoked_at IS NULL`, at.UTC(), subject)
+	if err != nil {
+		return err
+	}
+	if err := revokeSubjectTokens(ctx, tx, subject, at); err != nil {
+		return err
+	}
+	if err := insertSessionAudit(ctx, tx, store.AuditUserLoggedOutAll, subject, nil, at); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) RevokeSubjectTokens(ctx context.Context, subject string, issuedBefore time.Time) error {
+	return revokeSubjectTokens(ctx, db.DB, subject, issuedBefore)
+}
+
+func revokeSubjectTokens(ctx context.Context, q execQueryer, subject string, issuedBefore time.Time) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO subject_revocations (subject, revoked_before) VALUES ($1, $2)
+		ON CONFLICT (subject) DO UPDATE
+		SET revoked_before = GREATEST(subject_revocations.revoked_before, EXCLUDED.revoked_before)`,
+		subject, issuedBefore.UTC().Truncate(time.Microsecond))
+	return err
+}
+
+func (db *PostgresDB) IsAccessTokenRevoked(ctx context.Context, tokenID, subject string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR EXISTS (SELECT 1 FROM subject_revocations WHERE subject = $2 AND revoked_before >= $3)`,
+		tokenID, subject, issuedAt.UTC()).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// scanUser reads a row selected with userColumns.
+func scanUser(row interface{ Scan(...interface{}) error }, u *store.User) error {
+	return row.Scan(&u.ID, &u.Email, &u.Password, &u.Type, &u.DisabledAt)
+}
+
+// User administration methods
+func (db *PostgresDB) SearchUsers(ctx context.Context, query store.UserQuery) ([]store.User, error) {
+	var args []interface{}
+	add := func(cond string, arg interface{}) string {
+		args = append(args, arg)
+		return fmt.Sprintf(cond, len(args))
+	}
+
+	conds := []string{"TRUE"}
+	if query.Email != "" {
+		conds = append(conds, add("lower(email) LIKE $%d", "%"+escapeLike(strings.ToLower(query.Email))+"%"))
+	}
+	if query.Role != "" {
+		conds = append(conds, add("type = $%d", query.Role))
+	}
+	if query.Disabled != nil {
+		if *query.Disabled {
+			conds = append(conds, "disabled_at IS NOT NULL")
+		} else {
+			conds = append(conds, "disabled_at IS NULL")
+		}
+	}
+	if query.AfterID != 0 {
+		conds = append(conds, add("id > $%d", query.AfterID))
+	}
+
+	q := `SELECT ` + userColumns + ` FROM users
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY id`
+	if query.Limit > 0 {
+		q += add(" LIMIT $%d", query.Limit)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []store.User
+	for rows.Next() {
+		var u store.User
+		if err := scanUser(rows, &u); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (db *PostgresDB) UpdateUser(ctx context.Context, update store.UserUpdate) (*store.User, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current store.User
+	err = scanUser(tx.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 FOR UPDATE", update.ID), &current)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	u := update.Apply(current)
+	_, err = tx.ExecContext(ctx, "UPDATE users SET type = $1, password = $2, disabled_at = $3 WHERE id = $4",
+		u.Type, u.Password, utcOrNil(u.DisabledAt), u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := store.NewUserAuditRecord(ctx, update.AuditAction(), current, u, update.At)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Invitation methods
+func (db *PostgresDB) CreateInvitation(ctx context.Context, inv *store.Invitation) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO invitations (token_hash, email, role, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		inv.TokenHash, inv.Email, inv.Role, inv.CreatedBy, inv.CreatedAt.UTC(), inv.ExpiresAt.UTC(),
+	).Scan(&inv.ID)
+	if err != nil {
+		return err
+	}
+
+	record, err := store.NewAuditRecord(ctx, store.AuditInvitationCreated, store.AuditEntityInvitation,
+		strconv.FormatInt(inv.ID, 10), nil, inv, inv.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) AcceptInvitation(ctx context.Context, tokenHash string, user *store.User, at time.Time) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inv store.Invitation
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, email, role, expires_at, accepted_at FROM invitations
+		WHERE token_hash = $1 FOR UPDATE`, tokenHash,
+	).Scan(&inv.ID, &inv.Email, &inv.Role, &inv.ExpiresAt, &inv.AcceptedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrInvitationInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if err := store.CheckInvitation(inv, user.Email, at); err != nil {
+		return err
+	}
+
+	user.Type = inv.Role
+	if err := insertUser(ctx, tx, user, at); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE invitations SET accepted_at = $1 WHERE id = $2", at.UTC(), inv.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strconv"
+	"time"
+
+	"avtest/internal/store"
+
+	"github.com/lib/pq"
+)
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	response_code, last_error, created_at, delivered_at`
+
+// Webhook methods
+func (db *PostgresDB) CreateWebhook(ctx context.Context, webhook *store.Webhook) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO webhooks (url, secret, event_types, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		webhook.URL, webhook.Secret, pq.Array(webhook.EventTypes), webhook.CreatedBy, webhook.CreatedAt.UTC(),
+	).Scan(&webhook.ID)
+	if err != nil {
+		return err
+	}
+
+	record, err := store.NewWebhookAuditRecord(ctx, store.AuditWebhookCreated, nil, webhook, webhook.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) GetWebhook(ctx context.Context, id int64) (*store.Webhook, error) {
+	row := db.DB.QueryRowContext(ctx, `
+		SELECT id, url, secret, event_types, created_by, created_at FROM webhooks WHERE id = $1`, id)
+	var w store.Webhook
+	err := row.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.EventTypes), &w.CreatedBy, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (db *PostgresDB) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT id, url, secret, event_types, created_by, created_at FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []store.Webhook
+	for rows.Next() {
+		var w store.Webhook
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.EventTypes), &w.CreatedBy, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (db *PostgresDB) DeleteWebhook(ctx context.Context, id int64) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var w store.Webhook
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM webhooks WHERE id = $1
+		RETURNING id, url, secret, event_types, created_by, created_at`, id,
+	).Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.EventTypes), &w.CreatedBy, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return store.ErrWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	record, err := store.NewWebhookAuditRecord(ctx, store.AuditWebhookDeleted, &w, nil, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Webhook delivery methods
+func (db *PostgresDB) CreateWebhookDeliveries(ctx context.Context, deliveries []store.WebhookDelivery) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range deliveries {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+			d.WebhookID, d.EventID, d.EventType, []byte(d.Payload), d.Status, d.NextAttemptAt.UTC(), d.CreatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *PostgresDB) ClaimWebhookDeliveries(ctx context.Context, now, claimUntil time.Time, limit int) ([]store.WebhookDelivery, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		UPDATE webhook_deliveries SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		claimUntil.UTC(), store.DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING doesn't keep the order of the subquery.
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries, nil
+}
+
+func (db *PostgresDB) UpdateWebhookDelivery(ctx context.Context, d *store.WebhookDelivery) error {
+	_, err := db.DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, response_code = $4, last_error = $5, delivered_at = $6
+		WHERE id = $7`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC(), d.ResponseCode, d.LastError, utcOrNil(d.DeliveredAt), d.ID)
+	return err
+}
+
+func (db *PostgresDB) ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]store.WebhookDelivery, error) {
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`,
+		webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows)
+}
+
+func (db *PostgresDB) ReplayWebhookDelivery(ctx context.Context, webhookID, deliveryID int64, now time.Time) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = 0, next_attempt_at = $2, response_code = 0, last_error = '', delivered_at = NULL
+		WHERE id = $3 AND webhook_id = $4`,
+		store.DeliveryPending, now.UTC(), deliveryID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrWebhookDeliveryNotFound
+	}
+
+	record, err := store.NewAuditRecord(ctx, store.AuditWebhookDeliveryReplayed, store.AuditEntityWebhook,
+		strconv.FormatInt(webhookID, 10), nil, map[string]int64{"delivery_id": deliveryID}, now)
+	if err != nil {
+		return err
+	}
+	if err := insertAuditRecord(ctx, tx, &record); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanDeliveries(rows *sql.Rows) ([]store.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []store.WebhookDelivery
+	for rows.Next() {
+		var d store.WebhookDelivery
+		var payload []byte
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.ResponseCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Flat statuses.
+const (
+	StatusCreated      = "created"
+	StatusOnModeration = "on moderation"
+	StatusApproved     = "approved"
+	StatusDeclined     = "declined"
+)
+
+// Roles that drive flat status transitions. RoleSystem is used for changes
+// made by the service itself rather than on behalf of a user. RoleAdmin
+// manages the accounts and takes no part in moderation.
+const (
+	RoleClient    = "client"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleSystem    = "system"
+)
+
+var (
+	ErrUnknownStatus       = errors.New("unknown flat status")
+	ErrIllegalTransition   = errors.New("illegal flat status transition")
+	ErrTransitionForbidden = errors.New("role is not allowed to make this transition")
+)
+
+// TransitionError describes a rejected status change. It wraps one of
+// ErrUnknownStatus, ErrIllegalTransition or ErrTransitionForbidden.
+type TransitionError struct {
+	From string
+	To   string
+	Role string
+	Err  error
+}
+
+func (e *TransitionError) Error() string {
+	if e.Role != "" {
+		return fmt.Sprintf("%s: %q -> %q by %s", e.Err, e.From, e.To, e.Role)
+	}
+	return fmt.Sprintf("%s: %q -> %q", e.Err, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// Transition is an allowed status change and the roles that may make it.
+type Transition struct {
+	From  string
+	To    string
+	Roles []string
+}
+
+// transitions is the flat moderation state machine:
+//
+//	created -> on moderation -> approved | declined
+//	on moderation -> created (the moderation lease expired or was released)
+//	approved | declined -> created (the flat is edited and resubmitted)
+var transitions = []Transition{
+	{From: StatusCreated, To: StatusOnModeration, Roles: []string{RoleModerator}},
+	{From: StatusOnModeration, To: StatusApproved, Roles: []string{RoleModerator}},
+	{From: StatusOnModeration, To: StatusDeclined, Roles: []string{RoleModerator}},
+	{From: StatusOnModeration, To: StatusCreated, Roles: []string{RoleSystem}},
+	{From: StatusApproved, To: StatusCreated, Roles: []string{RoleClient, RoleAdmin, RoleModerator}},
+	{From: StatusDeclined, To: StatusCreated, Roles: []string{RoleClient, RoleAdmin, RoleModerator}},
+}
+
+// SeesAllFlats reports whether the role sees flats in every status. Only
+// moderators do; everyone else, admins included, sees what clients see.
+func SeesAllFlats(role string) bool {
+	return role == RoleModerator
+}
+
+// Statuses returns all flat statuses.
+func Statuses() []string {
+	return []string{StatusCreated, StatusOnModeration, StatusApproved, StatusDeclined}
+}
+
+func IsValidStatus(status string) bool {
+	for _, s := range Statuses() {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Transitions returns the allowed transitions out of the status.
+func Transitions(from string) []Transition {
+	var res []Transition
+	for _, t := range transitions {
+		if t.From == from {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// CheckTransition reports whether the state machine allows the change,
+// regardless of who makes it.
+func CheckTransition(from, to string) error {
+	_, err := findTransition(from, to)
+	return err
+}
+
+// CheckTransitionRole reports whether the role may change the status.
+func CheckTransitionRole(from, to, role string) error {
+	t, err := findTransition(from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range t.Roles {
+		if r == role {
+			return nil
+		}
+	}
+	return &TransitionError{From: from, To: to, Role: role, Err: ErrTransitionForbidden}
+}
+
+// CheckStatusChange reports whether the change may be made to the flat in
+// its current state. A flat under review may only be changed by the
+// moderator holding its lease, and only until the lease expires.
+func CheckStatusChange(current Flat, change FlatStatusChange) error {
+	if err := CheckVersion("flat", change.ExpectedVersion, current.Version); err != nil {
+		return err
+	}
+	if current.Status == StatusOnModeration {
+		if current.Moderator != change.Actor {
+			return ErrFlatModeratedByOther
+		}
+		if current.LeaseExpiresAt != nil && current.LeaseExpiresAt.Before(change.At) {
+			return ErrLeaseExpired
+		}
+	}
+
+	return CheckTransitionRole(current.Status, change.Status, change.Role)
+}
+
+func findTransition(from, to string) (Transition, error) {
+	if !IsValidStatus(from) || !IsValidStatus(to) {
+		return Transition{}, &TransitionError{From: from, To: to, Err: ErrUnknownStatus}
+	}
+
+	for _, t := range transitions {
+		if t.From == from && t.To == to {
+			return t, nil
+		}
+	}
+	return Transition{}, &TransitionError{From: from, To: to, Err: ErrIllegalTransition}
+}
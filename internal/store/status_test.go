@@ -0,0 +1,132 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTransitionRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		role    string
+		wantErr error
+	}{
+		{name: "take for moderation", from: StatusCreated, to: StatusOnModeration, role: RoleModerator},
+		{name: "approve", from: StatusOnModeration, to: StatusApproved, role: RoleModerator},
+		{name: "decline", from: StatusOnModeration, to: StatusDeclined, role: RoleModerator},
+		{name: "edit approved", from: StatusApproved, to: StatusCreated, role: RoleClient},
+		{name: "resubmit declined", from: StatusDeclined, to: StatusCreated, role: RoleClient},
+		{name: "moderator edits own flat", from: StatusApproved, to: StatusCreated, role: RoleModerator},
+		{name: "lease released", from: StatusOnModeration, to: StatusCreated, role: RoleSystem},
+
+		{name: "skip moderation", from: StatusCreated, to: StatusApproved, role: RoleModerator, wantErr: ErrIllegalTransition},
+		{name: "reopen declined", from: StatusDeclined, to: StatusOnModeration, role: RoleModerator, wantErr: ErrIllegalTransition},
+		{name: "approve declined", from: StatusDeclined, to: StatusApproved, role: RoleModerator, wantErr: ErrIllegalTransition},
+		{name: "decline approved", from: StatusApproved, to: StatusDeclined, role: RoleModerator, wantErr: ErrIllegalTransition},
+		{name: "same status", from: StatusOnModeration, to: StatusOnModeration, role: RoleModerator, wantErr: ErrIllegalTransition},
+		{name: "client takes for moderation", from: StatusCreated, to: StatusOnModeration, role: RoleClient, wantErr: ErrTransitionForbidden},
+		{name: "client approves", from: StatusOnModeration, to: StatusApproved, role: RoleClient, wantErr: ErrTransitionForbidden},
+		{name: "moderator drops review", from: StatusOnModeration, to: StatusCreated, role: RoleModerator, wantErr: ErrTransitionForbidden},
+		{name: "system approves", from: StatusOnModeration, to: StatusApproved, role: RoleSystem, wantErr: ErrTransitionForbidden},
+		{name: "unknown target", from: StatusCreated, to: "sold", role: RoleModerator, wantErr: ErrUnknownStatus},
+		{name: "unknown source", from: "", to: StatusCreated, role: RoleModerator, wantErr: ErrUnknownStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTransitionRole(tt.from, tt.to, tt.role)
+			require.ErrorIs(t, err, tt.wantErr)
+
+			if tt.wantErr != nil {
+				var transitionErr *TransitionError
+				require.ErrorAs(t, err, &transitionErr)
+				require.Equal(t, tt.from, transitionErr.From)
+				require.Equal(t, tt.to, transitionErr.To)
+			}
+		})
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		wantErr error
+	}{
+		{from: StatusCreated, to: StatusOnModeration},
+		{from: StatusOnModeration, to: StatusApproved},
+		{from: StatusOnModeration, to: StatusDeclined},
+		{from: StatusApproved, to: StatusCreated},
+		{from: StatusDeclined, to: StatusCreated},
+		{from: StatusOnModeration, to: StatusCreated},
+		{from: StatusCreated, to: StatusDeclined, wantErr: ErrIllegalTransition},
+		{from: StatusApproved, to: StatusOnModeration, wantErr: ErrIllegalTransition},
+		{from: StatusCreated, to: "unknown", wantErr: ErrUnknownStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" -> "+tt.to, func(t *testing.T) {
+			require.ErrorIs(t, CheckTransition(tt.from, tt.to), tt.wantErr)
+		})
+	}
+}
+
+func TestCheckStatusChange(t *testing.T) {
+	now := time.Now()
+	live, expired := now.Add(time.Minute), now.Add(-time.Minute)
+	underReview := Flat{Status: StatusOnModeration, Moderator: "moderator1", LeaseExpiresAt: &live}
+
+	tests := []struct {
+		name    string
+		current Flat
+		change  FlatStatusChange
+		wantErr error
+	}{
+		{
+			name:    "approve own review",
+			current: underReview,
+			change:  FlatStatusChange{Status: StatusApproved, Actor: "moderator1", Role: RoleModerator, At: now},
+		},
+		{
+			name:    "approve review of another moderator",
+			current: underReview,
+			change:  FlatStatusChange{Status: StatusApproved, Actor: "moderator2", Role: RoleModerator, At: now},
+			wantErr: ErrFlatModeratedByOther,
+		},
+		{
+			name:    "approve after lease expired",
+			current: Flat{Status: StatusOnModeration, Moderator: "moderator1", LeaseExpiresAt: &expired},
+			change:  FlatStatusChange{Status: StatusApproved, Actor: "moderator1", Role: RoleModerator, At: now},
+			wantErr: ErrLeaseExpired,
+		},
+		{
+			name:    "stale version",
+			current: Flat{Status: StatusCreated, Version: 3},
+			change:  FlatStatusChange{Status: StatusOnModeration, Actor: "moderator1", Role: RoleModerator, At: now, ExpectedVersion: 2},
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:    "current version",
+			current: Flat{Status: StatusCreated, Version: 3},
+			change:  FlatStatusChange{Status: StatusOnModeration, Actor: "moderator1", Role: RoleModerator, At: now, ExpectedVersion: 3},
+		},
+		{
+			name:    "take for moderation",
+			current: Flat{Status: StatusCreated},
+			change:  FlatStatusChange{Status: StatusOnModeration, Actor: "moderator2", Role: RoleModerator, At: now},
+		},
+		{
+			name:    "illegal transition",
+			current: Flat{Status: StatusCreated},
+			change:  FlatStatusChange{Status: StatusApproved, Actor: "moderator1", Role: RoleModerator, At: now},
+			wantErr: ErrIllegalTransition,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.ErrorIs(t, CheckStatusChange(tt.current, tt.change), tt.wantErr)
+		})
+	}
+}
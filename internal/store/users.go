@@ -0,0 +1,107 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// UserQuery selects a page of users, in id order. Zero fields don't filter.
+type UserQuery struct {
+	// Email matches the users whose email contains it, ignoring case.
+	Email    string
+	Role     string
+	Disabled *bool
+
+	// AfterID continues the listing past the user a previous page ended
+	// with.
+	AfterID int64
+	Limit   int
+}
+
+// Matches reports whether the user belongs to the listing, ignoring the
+// page boundaries.
+func (q UserQuery) Matches(u User) bool {
+	switch {
+	case q.Email != "" && !strings.Contains(strings.ToLower(u.Email), strings.ToLower(q.Email)):
+	case q.Role != "" && u.Type != q.Role:
+	case q.Disabled != nil && (u.DisabledAt != nil) != *q.Disabled:
+	default:
+		return true
+	}
+	return false
+}
+
+// UserUpdate changes an account on behalf of an admin. Nil fields are left
+// as they are.
+type UserUpdate struct {
+	ID       int64
+	Role     *string
+	Disabled *bool
+	// Password is the hash of a new password.
+	Password *string
+	At       time.Time
+}
+
+// Apply returns the user with the update applied. Disabling keeps the time
+// the account was first disabled.
+func (u UserUpdate) Apply(user User) User {
+	if u.Role != nil {
+		user.Type = *u.Role
+	}
+	if u.Disabled != nil {
+		switch {
+		case !*u.Disabled:
+			user.DisabledAt = nil
+		case user.DisabledAt == nil:
+			at := u.At
+			user.DisabledAt = &at
+		}
+	}
+	if u.Password != nil {
+		user.Password = *u.Password
+	}
+	return user
+}
+
+// AuditAction names the update in the audit log.
+func (u UserUpdate) AuditAction() string {
+	if u.Password != nil {
+		return AuditUserPasswordReset
+	}
+	return AuditUserUpdated
+}
+
+// UserProfile is a user without the password hash, as shown to admins and
+// stored in the audit log.
+type UserProfile struct {
+	ID         int64      `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+func (u User) Profile() UserProfile {
+	return UserProfile{ID: u.ID, Email: u.Email, Role: u.Type, DisabledAt: u.DisabledAt}
+}
+
+// Invitation lets whoever holds its token register Email with Role, once
+// and until it expires. Only the token hash is stored.
+type Invitation struct {
+	ID         int64      `json:"id"`
+	TokenHash  string     `json:"-"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	CreatedBy  string     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+// CheckInvitation reports whether the invitation lets the email register at
+// the given time.
+func CheckInvitation(inv Invitation, email string, at time.Time) error {
+	if inv.AcceptedAt != nil || !at.Before(inv.ExpiresAt) || !strings.EqualFold(inv.Email, email) {
+		return ErrInvitationInvalid
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Webhook delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a partner endpoint that receives events of the listed types.
+type Webhook struct {
+	ID         int64     `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types"`
+	CreatedBy  string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook is subscribed to the event type.
+func (w *Webhook) Wants(eventType string) bool {
+	return slices.Contains(w.EventTypes, eventType)
+}
+
+// WebhookDelivery is one event to be sent to one webhook, along with the
+// outcome of the last attempt.
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int64           `json:"webhook_id"`
+	EventID       int64           `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"avtest/internal/config"
+	"avtest/internal/store"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxRetryBackoff = 6 * time.Hour
+	// maxResponseBody caps how much of a response is read before the
+	// connection is reused.
+	maxResponseBody = 64 << 10
+)
+
+var errWebhookDeleted = errors.New("webhook has been deleted")
+
+// Deliverer sends queued deliveries. A delivery that doesn't get a 2xx
+// response is retried with exponential backoff until it runs out of
+// attempts and is marked failed.
+type Deliverer struct {
+	logger *zap.Logger
+	db     store.Database
+	client *http.Client
+
+	interval     time.Duration
+	batchSize    int
+	timeout      time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+
+	now func() time.Time
+}
+
+func NewDeliverer(logger *zap.Logger, db store.Database, cfg *config.Config) *Deliverer {
+	return &Deliverer{
+		logger:       logger,
+		db:           db,
+		client:       &http.Client{Timeout: cfg.WebhookTimeout},
+		interval:     cfg.WebhookPollInterval,
+		batchSize:    cfg.WebhookBatchSize,
+		timeout:      cfg.WebhookTimeout,
+		maxAttempts:  cfg.WebhookMaxAttempts,
+		retryBackoff: cfg.WebhookRetryBackoff,
+		now:          time.Now,
+	}
+}
+
+// Run delivers until the context is cancelled.
+func (d *Deliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while there is a backlog.
+		for ctx.Err() == nil {
+			if n := d.DeliverOnce(ctx); n < d.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverOnce attempts one batch of due deliveries and reports how many were
+// claimed.
+func (d *Deliverer) DeliverOnce(ctx context.Context) int {
+	now := d.now()
+	// The claim has to outlast sending the whole batch one by one.
+	claimUntil := now.Add(d.timeout * time.Duration(d.batchSize+1))
+	deliveries, err := d.db.ClaimWebhookDeliveries(ctx, now, claimUntil, d.batchSize)
+	if err != nil {
+		d.logger.Error("failed to claim webhook deliveries", zap.Error(err))
+		return 0
+	}
+
+	webhooks := make(map[int64]*store.Webhook)
+	for _, delivery := range deliveries {
+		w, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			w, err = d.db.GetWebhook(ctx, delivery.WebhookID)
+			if err != nil {
+				d.logger.Error("failed to get webhook", zap.Int64("id", delivery.WebhookID), zap.Error(err))
+				continue
+			}
+			webhooks[delivery.WebhookID] = w
+		}
+		d.deliver(ctx, w, delivery)
+	}
+	return len(deliveries)
+}
+
+func (d *Deliverer) deliver(ctx context.Context, w *store.Webhook, delivery store.WebhookDelivery) {
+	var code int
+	err := errWebhookDeleted
+	if w != nil {
+		code, err = d.send(ctx, w, delivery)
+	}
+
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	if err == nil {
+		at := d.now()
+		delivery.Status = store.DeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &at
+	} else {
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = d.now().Add(d.backoff(delivery.Attempts))
+		if delivery.Attempts >= d.maxAttempts || w == nil {
+			delivery.Status = store.DeliveryFailed
+		}
+		d.logger.Warn("webhook delivery failed",
+			zap.Int64("delivery_id", delivery.ID), zap.Int64("webhook_id", delivery.WebhookID),
+			zap.Int("attempts", delivery.Attempts), zap.Int("response_code", code), zap.Error(err))
+	}
+
+	if err := d.db.UpdateWebhookDelivery(ctx, &delivery); err != nil {
+		d.logger.Error("failed to update webhook delivery", zap.Int64("id", delivery.ID), zap.Error(err))
+	}
+}
+
+// send posts the delivery and returns the response code.
+func (d *Deliverer) send(ctx context.Context, w *store.Webhook, delivery store.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt after the given number
+// of failed ones.
+func (d *Deliverer) backoff(attempts int) time.Duration {
+	delay := d.retryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryBackoff)
+}
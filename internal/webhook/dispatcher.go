@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"avtest/internal/store"
+)
+
+// Dispatcher turns outbox events into deliveries for the webhooks
+// subscribed to them.
+type Dispatcher struct {
+	db store.Database
+}
+
+func NewDispatcher(db store.Database) *Dispatcher {
+	return &Dispatcher{db: db}
+}
+
+// HandleEvent queues a delivery of the event to every interested webhook.
+// It is safe to call twice for the same event.
+func (d *Dispatcher) HandleEvent(ctx context.Context, e store.Event) error {
+	webhooks, err := d.db.ListWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("list webhooks: %w", err)
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var deliveries []store.WebhookDelivery
+	for _, w := range webhooks {
+		if !w.Wants(e.Type) {
+			continue
+		}
+		deliveries = append(deliveries, store.WebhookDelivery{
+			WebhookID:     w.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       body,
+			Status:        store.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return d.db.CreateWebhookDeliveries(ctx, deliveries)
+}
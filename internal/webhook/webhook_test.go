@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"avtest/internal/config"
+	"avtest/internal/store"
+	"avtest/internal/store/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Unix(1700000000, 0)
+	sig := Sign("secret", now.Unix(), body)
+	ts := "1700000000"
+
+	require.NoError(t, Verify("secret", sig, ts, body, now, time.Minute))
+	require.ErrorIs(t, Verify("other", sig, ts, body, now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("secret", sig, ts, []byte(`{"id":2}`), now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("secret", sig, "1700000001", body, now, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("secret", sig, ts, body, now.Add(time.Hour), time.Minute), ErrStaleTimestamp)
+}
+
+// receiver records deliveries and checks their signatures against the test
+// clock.
+type receiver struct {
+	mu     sync.Mutex
+	now    *time.Time
+	status int
+	bodies [][]byte
+	errs   []error
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	rc.bodies = append(rc.bodies, body)
+	rc.errs = append(rc.errs, Verify("secret", r.Header.Get(SignatureHeader), r.Header.Get(TimestampHeader),
+		body, *rc.now, time.Minute))
+	w.WriteHeader(rc.status)
+}
+
+func TestDelivery(t *testing.T) {
+	ctx := context.Background()
+	var now time.Time
+	rc := &receiver{now: &now, status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	db := memory.NewMemoryDB()
+	require.NoError(t, db.CreateWebhook(ctx, &store.Webhook{
+		URL:        srv.URL,
+		Secret:     "secret",
+		EventTypes: []string{store.EventHouseCreated},
+	}))
+	require.NoError(t, db.CreateWebhook(ctx, &store.Webhook{
+		URL:        srv.URL,
+		Secret:     "secret",
+		EventTypes: []string{store.EventFlatApproved},
+	}))
+
+	event, err := store.NewHouseEvent(store.EventHouseCreated, store.House{HouseNumber: 1}, time.Now())
+	require.NoError(t, err)
+	event.ID = 1
+	dispatcher := NewDispatcher(db)
+	require.NoError(t, dispatcher.HandleEvent(context.Background(), event))
+	// The outbox may deliver the same event again.
+	require.NoError(t, dispatcher.HandleEvent(context.Background(), event))
+
+	now = time.Now()
+	d := NewDeliverer(zap.NewNop(), db, &config.Config{
+		WebhookBatchSize:    10,
+		WebhookTimeout:      time.Second,
+		WebhookMaxAttempts:  2,
+		WebhookRetryBackoff: time.Minute,
+	})
+	d.now = func() time.Time { return now }
+
+	require.Equal(t, 1, d.DeliverOnce(context.Background()))
+	require.Len(t, rc.bodies, 1)
+	require.NoError(t, rc.errs[0])
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, store.DeliveryPending, deliveries[0].Status)
+	require.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseCode)
+
+	// Retried after the backoff, then given up on.
+	require.Zero(t, d.DeliverOnce(context.Background()))
+	now = now.Add(time.Minute)
+	require.Equal(t, 1, d.DeliverOnce(context.Background()))
+	deliveries, err = db.ListWebhookDeliveries(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, store.DeliveryFailed, deliveries[0].Status)
+	require.Equal(t, 2, deliveries[0].Attempts)
+
+	now = now.Add(time.Hour)
+	require.Zero(t, d.DeliverOnce(context.Background()))
+
+	// A replay starts over and succeeds with the same body.
+	rc.mu.Lock()
+	rc.status = http.StatusNoContent
+	rc.mu.Unlock()
+	require.NoError(t, db.ReplayWebhookDelivery(ctx, 1, deliveries[0].ID, now))
+	require.Equal(t, 1, d.DeliverOnce(context.Background()))
+	require.Len(t, rc.bodies, 3)
+	require.Equal(t, rc.bodies[0], rc.bodies[2])
+	require.NoError(t, rc.errs[2])
+
+	deliveries, err = db.ListWebhookDeliveries(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Equal(t, store.DeliverySucceeded, deliveries[0].Status)
+	require.Equal(t, http.StatusNoContent, deliveries[0].ResponseCode)
+	require.NotNil(t, deliveries[0].DeliveredAt)
+
+	deliveries, err = db.ListWebhookDeliveries(ctx, 2, 10)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+}